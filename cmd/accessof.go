@@ -0,0 +1,215 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// accessOfCmd represents the access-of command
+var accessOfCmd = &cobra.Command{
+	Use:   "access-of",
+	Short: "List everything a user can reach",
+	Long: `List everything a user can reach.
+
+For the user given by --user, prints their organization role, every team
+they are a member of, directly or through a child team, every repository
+they can access with their effective permission, the deployment
+environments they can approve and the branch protection rules they can
+bypass, directly or through a team.
+
+The access configuration file is read by default. With --live the
+organization is exported from GitHub instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		user, _ := cmd.Flags().GetString("user")
+		live, _ := cmd.Flags().GetBool("live")
+		format, _ := cmd.Flags().GetString("output")
+
+		config, err := loadOrExportConfig(context.Background(), live)
+		if err != nil {
+			log.Fatal(err)
+		}
+		user = resolveUser(config.Organization.Login, user)
+
+		access := accessOf(config, user)
+		if format == "json" {
+			data, err := json.MarshalIndent(access, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(data))
+			return
+		}
+		printUserAccess(access)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(accessOfCmd)
+	accessOfCmd.Flags().String("user", "", "Login or corporate identity (NameID, SCIM username or email) of the user")
+	accessOfCmd.Flags().Bool("live", false, "Export the organization from GitHub instead of reading the access configuration file")
+	accessOfCmd.Flags().String("output", "text", "Output format: text or json")
+	accessOfCmd.MarkFlagRequired("user")
+}
+
+// UserAccess is everything a user can reach in an organization.
+type UserAccess struct {
+	Login string `json:"login"`
+	// Role is the organization role, empty for outside collaborators.
+	Role                 string                 `json:"role,omitempty"`
+	Teams                []TeamMembership       `json:"teams,omitempty"`
+	Repositories         []EffectivePermission  `json:"repositories,omitempty"`
+	EnvironmentReviewers []EnvironmentReviewer  `json:"environmentReviewers,omitempty"`
+	BypassedProtections  []BranchProtectionPass `json:"bypassedProtections,omitempty"`
+}
+
+// TeamMembership is a team of a user.
+type TeamMembership struct {
+	Team string `json:"team"`
+	// Via is the chain of child teams the membership is inherited through,
+	// empty for direct members.
+	Via []string `json:"via,omitempty"`
+}
+
+// EnvironmentReviewer is a deployment environment a user can approve.
+type EnvironmentReviewer struct {
+	Repo        string `json:"repo"`
+	Environment string `json:"environment"`
+	// Team is the reviewer team of the user, empty when the user is a
+	// reviewer directly.
+	Team string `json:"team,omitempty"`
+}
+
+// BranchProtectionPass is a branch protection rule a user can bypass.
+type BranchProtectionPass struct {
+	Repo    string `json:"repo"`
+	Pattern string `json:"pattern"`
+	// Team is the bypass team of the user, empty when the user can bypass
+	// the rule directly.
+	Team string `json:"team,omitempty"`
+}
+
+// accessOf returns everything login can reach according to config.
+func accessOf(config *AccessConfig, login string) UserAccess {
+	access := UserAccess{Login: login}
+	for _, member := range config.Members {
+		if strings.EqualFold(member.Login, login) {
+			access.Login, access.Role = member.Login, member.Role
+		}
+	}
+
+	var teams []string
+	for _, chain := range teamChains(config, login) {
+		team := chain[len(chain)-1]
+		teams = append(teams, team)
+		membership := TeamMembership{Team: team}
+		if len(chain) > 1 {
+			membership.Via = chain[:len(chain)-1]
+		}
+		access.Teams = append(access.Teams, membership)
+	}
+	// userTeam returns the first team of the user in candidates.
+	userTeam := func(candidates []string) (string, bool) {
+		for _, team := range teams {
+			for _, candidate := range candidates {
+				if sameTeam(config, candidate, team) {
+					return team, true
+				}
+			}
+		}
+		return "", false
+	}
+
+	access.Repositories = resolveUserPermissions(config, login)
+
+	for _, environment := range config.Environments {
+		if containsFold(environment.Users, login) {
+			access.EnvironmentReviewers = append(access.EnvironmentReviewers, EnvironmentReviewer{Repo: environment.Repo, Environment: environment.Name})
+		} else if team, ok := userTeam(environment.Teams); ok {
+			access.EnvironmentReviewers = append(access.EnvironmentReviewers, EnvironmentReviewer{Repo: environment.Repo, Environment: environment.Name, Team: team})
+		}
+	}
+
+	for _, protection := range config.BranchProtections {
+		if containsFold(protection.BypassUsers, login) {
+			access.BypassedProtections = append(access.BypassedProtections, BranchProtectionPass{Repo: protection.Repo, Pattern: protection.Pattern})
+		} else if team, ok := userTeam(protection.BypassTeams); ok {
+			access.BypassedProtections = append(access.BypassedProtections, BranchProtectionPass{Repo: protection.Repo, Pattern: protection.Pattern, Team: team})
+		}
+	}
+
+	return access
+}
+
+// printUserAccess prints access as text.
+func printUserAccess(access UserAccess) {
+	role := access.Role
+	if role == "" {
+		role = "outside collaborator"
+	}
+	fmt.Printf("%s (%s)\n", access.Login, role)
+
+	if len(access.Teams) > 0 {
+		fmt.Println("teams:")
+		for _, membership := range access.Teams {
+			if len(membership.Via) == 0 {
+				fmt.Printf("  %s\n", membership.Team)
+			} else {
+				fmt.Printf("  %s through %s\n", membership.Team, strings.Join(membership.Via, " → "))
+			}
+		}
+	}
+	if len(access.Repositories) > 0 {
+		fmt.Println("repositories:")
+		for _, permission := range access.Repositories {
+			fmt.Printf("  %s: %s\n", permission.Repo, permission.Grants[0].Describe())
+		}
+	}
+	if len(access.EnvironmentReviewers) > 0 {
+		fmt.Println("environment reviewer:")
+		for _, reviewer := range access.EnvironmentReviewers {
+			fmt.Printf("  %s/%s%s\n", reviewer.Repo, reviewer.Environment, throughTeam(reviewer.Team))
+		}
+	}
+	if len(access.BypassedProtections) > 0 {
+		fmt.Println("branch protection bypass:")
+		for _, pass := range access.BypassedProtections {
+			fmt.Printf("  %s %s%s\n", pass.Repo, pass.Pattern, throughTeam(pass.Team))
+		}
+	}
+	if len(access.Teams) == 0 && len(access.Repositories) == 0 && len(access.EnvironmentReviewers) == 0 && len(access.BypassedProtections) == 0 {
+		fmt.Println("no access")
+	}
+}
+
+func throughTeam(team string) string {
+	if team == "" {
+		return ""
+	}
+	return " through team " + team
+}
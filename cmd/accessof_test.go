@@ -0,0 +1,120 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAccessOf(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+
+	access := accessOf(config, "Erin")
+	if access.Login != "erin" || access.Role != "MEMBER" {
+		t.Errorf("login and role = %q %q", access.Login, access.Role)
+	}
+	wantTeams := []TeamMembership{{Team: "platform"}, {Team: "engineering", Via: []string{"platform"}}}
+	if !reflect.DeepEqual(access.Teams, wantTeams) {
+		t.Errorf("teams = %+v, want %+v", access.Teams, wantTeams)
+	}
+	var repos []string
+	for _, permission := range access.Repositories {
+		repos = append(repos, permission.Repo+" "+permission.Access)
+	}
+	if want := []string{"api WRITE", "docs READ", "infra ADMIN", "tools READ", "web WRITE"}; !reflect.DeepEqual(repos, want) {
+		t.Errorf("repositories = %v, want %v", repos, want)
+	}
+	wantReviewers := []EnvironmentReviewer{
+		{Repo: "api", Environment: "production", Team: "platform"},
+		{Repo: "infra", Environment: "production", Team: "platform"},
+	}
+	if !reflect.DeepEqual(access.EnvironmentReviewers, wantReviewers) {
+		t.Errorf("environment reviewers = %+v, want %+v", access.EnvironmentReviewers, wantReviewers)
+	}
+	if len(access.BypassedProtections) != 0 {
+		t.Errorf("bypassed protections = %+v, want none", access.BypassedProtections)
+	}
+
+	access = accessOf(config, "carol")
+	wantPasses := []BranchProtectionPass{{Repo: "api", Pattern: "main"}}
+	if !reflect.DeepEqual(access.BypassedProtections, wantPasses) {
+		t.Errorf("bypassed protections of carol = %+v, want %+v", access.BypassedProtections, wantPasses)
+	}
+
+	access = accessOf(config, "frank")
+	wantPasses = []BranchProtectionPass{{Repo: "api", Pattern: "main", Team: "security"}}
+	if !reflect.DeepEqual(access.BypassedProtections, wantPasses) {
+		t.Errorf("bypassed protections of frank = %+v, want %+v", access.BypassedProtections, wantPasses)
+	}
+
+	access = accessOf(config, "outsider")
+	if access.Role != "" || len(access.Teams) != 0 || len(access.Repositories) != 1 {
+		t.Errorf("access of outsider = %+v", access)
+	}
+}
+
+// exportNestedTeams exports acme with erin also in a grandchild team of
+// engineering, on-call under backend, through the fake GraphQL API.
+func exportNestedTeams(t *testing.T) *AccessConfig {
+	t.Helper()
+	org := loadFixture(t, "acme.yaml")
+	org.Teams = append(org.Teams, TeamInfo{Name: "On-call", Slug: "on-call", DatabaseID: 105, Privacy: "VISIBLE", Members: []string{"erin"}})
+	backend := findTeam(org, "backend")
+	backend.ChildTeams = append(backend.ChildTeams, "On-call")
+
+	config, _, err := exportWithFake(t, newFakeGitHub(t, 2, org), "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	return config
+}
+
+func TestAccessOfNestedTeams(t *testing.T) {
+	access := accessOf(exportNestedTeams(t), "erin")
+
+	want := []TeamMembership{
+		{Team: "platform"},
+		{Team: "on-call"},
+		{Team: "engineering", Via: []string{"platform"}},
+		{Team: "backend", Via: []string{"on-call"}},
+	}
+	if !reflect.DeepEqual(access.Teams, want) {
+		t.Errorf("teams = %+v, want %+v", access.Teams, want)
+	}
+}
+
+func TestGetProtectionsSkipsForbiddenRepositories(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.forbidden = []string{"repos/acme/api/environments"}
+
+	got, _, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	if len(got.Environments) != 1 || got.Environments[0].Repo != "infra" {
+		t.Errorf("environments = %+v, want infra only", got.Environments)
+	}
+	if len(got.BranchProtections) != 2 {
+		t.Errorf("branch protections = %+v", got.BranchProtections)
+	}
+}
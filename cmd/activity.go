@@ -0,0 +1,175 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Kinds of repository activity.
+const (
+	activityCommit      = "commit"
+	activityPush        = "push"
+	activityMerge       = "merge"
+	activityBranch      = "branch"
+	activityRelease     = "release"
+	activityPullRequest = "pull_request"
+	activityReview      = "review"
+	activityComment     = "comment"
+	activityAdmin       = "admin"
+)
+
+// activityPermission is the lowest permission each kind of activity needs.
+// Commits count as writes even though they may come from a fork, so that
+// recommendations never take away a permission that is in use.
+var activityPermission = map[string]string{
+	activityCommit:      "WRITE",
+	activityPush:        "WRITE",
+	activityMerge:       "WRITE",
+	activityBranch:      "WRITE",
+	activityRelease:     "WRITE",
+	activityPullRequest: "READ",
+	activityReview:      "READ",
+	activityComment:     "READ",
+	activityAdmin:       "ADMIN",
+}
+
+// RepoActivity is an action of a user on a repository.
+type RepoActivity struct {
+	Login string
+	Repo  string
+	Kind  string
+	At    time.Time
+}
+
+// repoEventKinds maps the repository event types to activity kinds.
+var repoEventKinds = map[string]string{
+	"PushEvent":                     activityPush,
+	"CreateEvent":                   activityBranch,
+	"DeleteEvent":                   activityBranch,
+	"ReleaseEvent":                  activityRelease,
+	"PullRequestEvent":              activityPullRequest,
+	"PullRequestReviewEvent":        activityReview,
+	"PullRequestReviewCommentEvent": activityReview,
+	"IssuesEvent":                   activityComment,
+	"IssueCommentEvent":             activityComment,
+	"CommitCommentEvent":            activityComment,
+	"MemberEvent":                   activityAdmin,
+	"PublicEvent":                   activityAdmin,
+}
+
+// getRepoActivity returns the activity on a repository since the given time,
+// from its commits, its pull requests and its events. Events only go back 90
+// days, so older activity is only seen through commits and pull requests.
+func getRepoActivity(ctx context.Context, client *http.Client, organization string, repo string, since time.Time) ([]RepoActivity, error) {
+	var activity []RepoActivity
+	add := func(login string, kind string, at time.Time) {
+		if login != "" && !at.Before(since) {
+			activity = append(activity, RepoActivity{Login: login, Repo: repo, Kind: kind, At: at})
+		}
+	}
+
+	commits, err := restGetAll[struct {
+		Author *struct {
+			Login string `json:"login"`
+		} `json:"author"`
+		Commit struct {
+			Author struct {
+				Date time.Time `json:"date"`
+			} `json:"author"`
+		} `json:"commit"`
+	}](ctx, client, fmt.Sprintf("repos/%s/%s/commits?since=%s", organization, repo, url.QueryEscape(since.UTC().Format(time.RFC3339))))
+	if err != nil && !isEmptyRepository(err) {
+		return nil, fmt.Errorf("commits of %s: %w", repo, err)
+	}
+	for _, commit := range commits {
+		// Commits by authors without a GitHub account have no author.
+		if commit.Author != nil {
+			add(commit.Author.Login, activityCommit, commit.Commit.Author.Date)
+		}
+	}
+
+	// Pull requests are listed from the most recently updated, so listing
+	// stops at the first one not updated since the start of the window.
+	next := fmt.Sprintf("repos/%s/%s/pulls?state=all&sort=updated&direction=desc&per_page=100", organization, repo)
+	for next != "" {
+		var pulls []struct {
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			CreatedAt time.Time `json:"created_at"`
+			UpdatedAt time.Time `json:"updated_at"`
+		}
+		next, err = restRequest(ctx, client, http.MethodGet, next, nil, &pulls)
+		if err != nil {
+			return nil, fmt.Errorf("pull requests of %s: %w", repo, err)
+		}
+		for _, pull := range pulls {
+			if pull.UpdatedAt.Before(since) {
+				next = ""
+				break
+			}
+			add(pull.User.Login, activityPullRequest, pull.CreatedAt)
+		}
+	}
+
+	events, err := restGetAll[struct {
+		Type  string `json:"type"`
+		Actor struct {
+			Login string `json:"login"`
+		} `json:"actor"`
+		Payload struct {
+			Action      string `json:"action"`
+			PullRequest struct {
+				Merged bool `json:"merged"`
+			} `json:"pull_request"`
+		} `json:"payload"`
+		CreatedAt time.Time `json:"created_at"`
+	}](ctx, client, fmt.Sprintf("repos/%s/%s/events", organization, repo))
+	if err != nil {
+		return nil, fmt.Errorf("events of %s: %w", repo, err)
+	}
+	for _, event := range events {
+		kind, ok := repoEventKinds[event.Type]
+		if !ok {
+			continue
+		}
+		// The actor of a closed and merged pull request is who merged it.
+		if event.Type == "PullRequestEvent" && event.Payload.Action == "closed" && event.Payload.PullRequest.Merged {
+			kind = activityMerge
+		}
+		add(event.Actor.Login, kind, event.CreatedAt)
+	}
+
+	return activity, nil
+}
+
+// isEmptyRepository reports whether err is the 409 Conflict that the commits
+// of an empty repository answer with.
+func isEmptyRepository(err error) bool {
+	restErr, ok := err.(*RESTError)
+	return ok && restErr.StatusCode == http.StatusConflict
+}
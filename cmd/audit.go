@@ -0,0 +1,489 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// auditActions are the audit log actions that change access.
+var auditActions = map[string]bool{
+	"team.create":                              true,
+	"team.destroy":                             true,
+	"team.add_member":                          true,
+	"team.remove_member":                       true,
+	"team.add_repository":                      true,
+	"team.remove_repository":                   true,
+	"team.update_repository_permission":        true,
+	"team.change_parent_team":                  true,
+	"org.add_member":                           true,
+	"org.remove_member":                        true,
+	"org.update_member":                        true,
+	"org.invite_member":                        true,
+	"org.cancel_invitation":                    true,
+	"org.add_outside_collaborator":             true,
+	"org.remove_outside_collaborator":          true,
+	"org.update_default_repository_permission": true,
+	"repo.add_member":                          true,
+	"repo.remove_member":                       true,
+	"repo.update_member":                       true,
+}
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Explain who changed access and when from the organization audit log",
+	Long: `Explain who changed access and when from the organization audit log.
+
+Team, member, repository permission and invitation events are read from the
+audit log of the organization, or from an audit log exported as JSON or CSV
+with --file, and correlated with the access configuration file. Events whose
+result does not match the file are marked as drift.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		since, _ := cmd.Flags().GetString("since")
+		until, _ := cmd.Flags().GetString("until")
+		driftOnly, _ := cmd.Flags().GetBool("drift-only")
+
+		from, err := parseAuditTime(since, time.Now())
+		if err != nil {
+			log.Fatalf("Invalid --since: %v", err)
+		}
+		to := time.Now()
+		if until != "" {
+			to, err = parseAuditTime(until, time.Now())
+			if err != nil {
+				log.Fatalf("Invalid --until: %v", err)
+			}
+		}
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Printf("Failed to load config, events will not be correlated: %v\n", err)
+			config = nil
+		}
+
+		var events []AuditEvent
+		if file != "" {
+			events, err = readAuditLogFile(file)
+			if err != nil {
+				log.Fatalf("Failed to read audit log %s: %v", file, err)
+			}
+		} else {
+			organization, err := targetOrganization()
+			if err != nil {
+				if config == nil || config.Organization.Login == "" {
+					log.Fatal(err)
+				}
+				organization = config.Organization.Login
+			}
+
+			ctx := context.Background()
+			events, err = mustGitHubProvider(ctx, organization).AuditLog(ctx, organization, from, to)
+			if err != nil {
+				log.Fatalf("Failed to get the audit log of %s: %v", organization, err)
+			}
+		}
+
+		events = filterAuditEvents(events, from, to)
+
+		// Only the latest event of each subject is expected to match the file.
+		latest := make(map[string]int)
+		for i, event := range events {
+			latest[event.subject()] = i
+		}
+
+		for i, event := range events {
+			status := ""
+			if config != nil {
+				reflected, known := event.ReflectedIn(config)
+				if latest[event.subject()] != i {
+					known = false
+				}
+				if known && !reflected {
+					status = " [drift]"
+				} else if driftOnly {
+					continue
+				}
+			}
+			fmt.Printf("%s%s\n", event.Describe(), status)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().String("file", "", "Audit log exported as JSON or CSV to read instead of the live audit log")
+	auditCmd.Flags().String("since", "7d", "Start of the time window, as a duration ago (72h, 30d) or a date (2006-01-02)")
+	auditCmd.Flags().String("until", "", "End of the time window, as a duration ago or a date. By default now.")
+	auditCmd.Flags().Bool("drift-only", false, "Only print the events that do not match the access configuration file")
+	auditCmd.MarkFlagFilename("file", "json", "csv")
+}
+
+// AuditEvent represents an access related audit log event.
+type AuditEvent struct {
+	Action     string
+	Actor      string
+	User       string
+	Team       string
+	Repo       string
+	Permission string
+	CreatedAt  time.Time
+}
+
+// Describe returns a human readable sentence for the event.
+func (e AuditEvent) Describe() string {
+	var what string
+	switch e.Action {
+	case "team.create":
+		what = fmt.Sprintf("team %s was created", e.Team)
+	case "team.destroy":
+		what = fmt.Sprintf("team %s was deleted", e.Team)
+	case "team.add_member":
+		what = fmt.Sprintf("%s was added to team %s", e.User, e.Team)
+	case "team.remove_member":
+		what = fmt.Sprintf("%s was removed from team %s", e.User, e.Team)
+	case "team.add_repository":
+		what = fmt.Sprintf("team %s was granted access to %s", e.Team, e.Repo)
+	case "team.remove_repository":
+		what = fmt.Sprintf("team %s lost access to %s", e.Team, e.Repo)
+	case "team.update_repository_permission":
+		what = fmt.Sprintf("permission of team %s on %s was changed", e.Team, e.Repo)
+	case "team.change_parent_team":
+		what = fmt.Sprintf("parent of team %s was changed", e.Team)
+	case "org.add_member":
+		what = fmt.Sprintf("%s was added to the organization", e.User)
+	case "org.remove_member":
+		what = fmt.Sprintf("%s was removed from the organization", e.User)
+	case "org.update_member":
+		what = fmt.Sprintf("role of %s was changed", e.User)
+	case "org.invite_member":
+		what = fmt.Sprintf("%s was invited to the organization", e.User)
+	case "org.cancel_invitation":
+		what = fmt.Sprintf("invitation of %s was cancelled", e.User)
+	case "org.add_outside_collaborator":
+		what = fmt.Sprintf("%s was added as outside collaborator", e.User)
+	case "org.remove_outside_collaborator":
+		what = fmt.Sprintf("%s was removed as outside collaborator", e.User)
+	case "org.update_default_repository_permission":
+		what = "the base repository permission was changed"
+	case "repo.add_member":
+		what = fmt.Sprintf("%s was added to %s", e.User, e.Repo)
+	case "repo.remove_member":
+		what = fmt.Sprintf("%s was removed from %s", e.User, e.Repo)
+	case "repo.update_member":
+		what = fmt.Sprintf("permission of %s on %s was changed", e.User, e.Repo)
+	default:
+		what = e.Action
+	}
+
+	if e.Permission != "" {
+		what = fmt.Sprintf("%s (%s)", what, e.Permission)
+	}
+
+	return fmt.Sprintf("%s by %s at %s", what, e.Actor, e.CreatedAt.UTC().Format(time.RFC3339))
+}
+
+// subject identifies what the event changed, so that later events on the
+// same subject supersede earlier ones.
+func (e AuditEvent) subject() string {
+	category := e.Action
+	if i := strings.Index(e.Action, "."); i >= 0 {
+		category = e.Action[:i]
+	}
+	switch e.Action {
+	case "team.add_repository", "team.remove_repository", "team.update_repository_permission":
+		category = "team-repo"
+	case "team.create", "team.destroy":
+		category = "team-lifecycle"
+	}
+	return strings.ToLower(strings.Join([]string{category, e.User, e.Team, e.Repo}, "/"))
+}
+
+// ReflectedIn reports whether the result of the event matches the access
+// configuration. known is false for actions that cannot be correlated.
+func (e AuditEvent) ReflectedIn(config *AccessConfig) (reflected bool, known bool) {
+	switch e.Action {
+	case "team.add_member", "team.remove_member":
+		team := findTeam(config, e.Team)
+		if team == nil {
+			return e.Action == "team.remove_member", true
+		}
+		present := containsFold(team.Members, e.User)
+		return present == (e.Action == "team.add_member"), true
+	case "team.add_repository", "team.remove_repository", "team.update_repository_permission":
+		present := false
+		for _, permission := range config.Permissions.Teams {
+			if sameTeam(config, permission.Slug, e.Team) && strings.EqualFold(permission.Repo, e.Repo) {
+				present = true
+			}
+		}
+		return present == (e.Action != "team.remove_repository"), true
+	case "team.create", "team.destroy":
+		present := findTeam(config, e.Team) != nil
+		return present == (e.Action == "team.create"), true
+	case "org.add_member", "org.remove_member", "org.update_member":
+		present := false
+		for _, member := range config.Members {
+			if strings.EqualFold(member.Login, e.User) {
+				present = true
+			}
+		}
+		return present == (e.Action != "org.remove_member"), true
+	case "repo.add_member", "repo.remove_member", "repo.update_member":
+		present := false
+		for _, permission := range config.Permissions.Users {
+			if strings.EqualFold(permission.Login, e.User) && strings.EqualFold(permission.Repo, e.Repo) {
+				present = true
+			}
+		}
+		return present == (e.Action != "repo.remove_member"), true
+	}
+	return false, false
+}
+
+func findTeam(config *AccessConfig, slug string) *TeamInfo {
+	for i := range config.Teams {
+		if strings.EqualFold(config.Teams[i].Slug, slug) || strings.EqualFold(config.Teams[i].Name, slug) {
+			return &config.Teams[i]
+		}
+	}
+	return nil
+}
+
+// sameTeam reports whether a and b, each a team slug or name, refer to the same team.
+func sameTeam(config *AccessConfig, a string, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	team := findTeam(config, a)
+	return team != nil && (strings.EqualFold(team.Slug, b) || strings.EqualFold(team.Name, b))
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAuditTime parses a duration ago (72h, 30d) or a date relative to now.
+func parseAuditTime(value string, now time.Time) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration nor a date", value)
+}
+
+func getAuditLog(ctx context.Context, client *http.Client, organization string, from time.Time, to time.Time) ([]AuditEvent, error) {
+	var events []AuditEvent
+
+	for _, category := range []string{"team", "org", "repo"} {
+		phrase := fmt.Sprintf("action:%s created:%s..%s", category, from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"))
+		path := fmt.Sprintf("orgs/%s/audit-log?include=web&phrase=%s", organization, url.QueryEscape(phrase))
+
+		entries, err := restGetAll[map[string]interface{}](ctx, client, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if event, ok := newAuditEvent(entry); ok {
+				events = append(events, event)
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// readAuditLogFile reads an audit log exported from GitHub as JSON (an array
+// or one object per line) or CSV.
+func readAuditLogFile(filename string) ([]AuditEvent, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []map[string]interface{}
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		entries, err = readAuditLogCSV(data)
+	} else {
+		entries, err = readAuditLogJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []AuditEvent
+	for _, entry := range entries {
+		if event, ok := newAuditEvent(entry); ok {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func readAuditLogJSON(data []byte) ([]map[string]interface{}, error) {
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(data, &entries); err == nil {
+		return entries, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var entry map[string]interface{}
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func readAuditLogCSV(data []byte) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	var entries []map[string]interface{}
+	for _, record := range records[1:] {
+		entry := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			if i < len(record) && record[i] != "" {
+				entry[strings.TrimSpace(column)] = record[i]
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// newAuditEvent converts a raw audit log entry. ok is false for actions that
+// do not change access.
+func newAuditEvent(entry map[string]interface{}) (AuditEvent, bool) {
+	event := AuditEvent{
+		Action:     auditString(entry, "action"),
+		Actor:      auditString(entry, "actor"),
+		User:       auditString(entry, "user"),
+		Team:       auditString(entry, "team"),
+		Repo:       auditString(entry, "repo", "repository"),
+		Permission: auditString(entry, "permission"),
+	}
+	if !auditActions[event.Action] {
+		return AuditEvent{}, false
+	}
+
+	// Teams and repositories are reported as "org/name".
+	if i := strings.LastIndex(event.Team, "/"); i >= 0 {
+		event.Team = event.Team[i+1:]
+	}
+	if i := strings.LastIndex(event.Repo, "/"); i >= 0 {
+		event.Repo = event.Repo[i+1:]
+	}
+
+	for _, key := range []string{"@timestamp", "created_at"} {
+		if t, ok := auditTime(entry[key]); ok {
+			event.CreatedAt = t
+			break
+		}
+	}
+
+	return event, true
+}
+
+func auditString(entry map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := entry[key]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// auditTime parses a timestamp in milliseconds since epoch or RFC 3339.
+func auditTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case float64:
+		return time.UnixMilli(int64(v)), true
+	case string:
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.UnixMilli(ms), true
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func filterAuditEvents(events []AuditEvent, from time.Time, to time.Time) []AuditEvent {
+	var filtered []AuditEvent
+	for _, event := range events {
+		if event.CreatedAt.Before(from) || event.CreatedAt.After(to) {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].CreatedAt.Before(filtered[j].CreatedAt)
+	})
+	return filtered
+}
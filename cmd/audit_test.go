@@ -0,0 +1,137 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// wantAuditEvents are the access events of testdata/audit-log.json and .csv.
+var wantAuditEvents = []AuditEvent{
+	{Action: "team.add_member", Actor: "alice", User: "carol", Team: "backend", CreatedAt: time.UnixMilli(1717243200000)},
+	{Action: "repo.add_member", Actor: "alice", User: "mallory", Repo: "tools", Permission: "admin", CreatedAt: time.UnixMilli(1717246800000)},
+	{Action: "team.remove_repository", Actor: "bob", Team: "frontend", Repo: "web", CreatedAt: time.UnixMilli(1717254000000)},
+	{Action: "org.remove_member", Actor: "alice", User: "zoe", CreatedAt: time.UnixMilli(1717257600000)},
+}
+
+func TestReadAuditLogFile(t *testing.T) {
+	for _, name := range []string{"audit-log.json", "audit-log.csv"} {
+		events, err := readAuditLogFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(events, wantAuditEvents) {
+			t.Errorf("%s: events = %+v, want %+v", name, events, wantAuditEvents)
+		}
+	}
+}
+
+func TestReadAuditLogJSONLines(t *testing.T) {
+	lines := `{"created_at": "2024-06-01T12:00:00Z", "action": "org.add_member", "actor": "alice", "user": "zoe"}
+{"created_at": 1717246800000, "action": "repo.destroy", "actor": "alice", "repository": "acme/old"}
+`
+	path := filepath.Join(t.TempDir(), "audit-log.jsonl")
+	if err := os.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events, err := readAuditLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AuditEvent{{Action: "org.add_member", Actor: "alice", User: "zoe", CreatedAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %+v, want %+v", events, want)
+	}
+
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readAuditLogFile(path); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestAuditEventReflectedIn(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	tests := []struct {
+		event     AuditEvent
+		reflected bool
+		known     bool
+	}{
+		{AuditEvent{Action: "team.add_member", User: "carol", Team: "backend"}, true, true},
+		{AuditEvent{Action: "team.add_member", User: "CAROL", Team: "Backend"}, true, true},
+		{AuditEvent{Action: "team.remove_member", User: "carol", Team: "backend"}, false, true},
+		{AuditEvent{Action: "team.remove_member", User: "carol", Team: "ghosts"}, true, true},
+		{AuditEvent{Action: "team.add_repository", Team: "backend", Repo: "api"}, true, true},
+		{AuditEvent{Action: "team.remove_repository", Team: "frontend", Repo: "web"}, false, true},
+		{AuditEvent{Action: "team.create", Team: "security"}, true, true},
+		{AuditEvent{Action: "team.destroy", Team: "security"}, false, true},
+		{AuditEvent{Action: "org.add_member", User: "bob"}, true, true},
+		{AuditEvent{Action: "org.remove_member", User: "zoe"}, true, true},
+		{AuditEvent{Action: "repo.add_member", User: "mallory", Repo: "tools"}, true, true},
+		{AuditEvent{Action: "repo.remove_member", User: "bob", Repo: "api"}, false, true},
+		{AuditEvent{Action: "org.invite_member", User: "zoe"}, false, false},
+	}
+	for _, tt := range tests {
+		reflected, known := tt.event.ReflectedIn(config)
+		if reflected != tt.reflected || known != tt.known {
+			t.Errorf("%s %s/%s/%s: reflected, known = %v, %v, want %v, %v", tt.event.Action, tt.event.User, tt.event.Team, tt.event.Repo, reflected, known, tt.reflected, tt.known)
+		}
+	}
+}
+
+func TestFilterAuditEvents(t *testing.T) {
+	events := []AuditEvent{wantAuditEvents[3], wantAuditEvents[0], wantAuditEvents[2], wantAuditEvents[1]}
+	got := filterAuditEvents(events, time.UnixMilli(1717246800000), time.UnixMilli(1717254000000))
+	want := []AuditEvent{wantAuditEvents[1], wantAuditEvents[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filtered = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseAuditTime(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"30d":        time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC),
+		"72h":        time.Date(2024, 6, 27, 12, 0, 0, 0, time.UTC),
+		"2024-06-01": time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for value, want := range tests {
+		if got, err := parseAuditTime(value, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseAuditTime(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseAuditTime("yesterday", now); err == nil {
+		t.Error("expected an error for yesterday")
+	}
+}
+
+func TestAuditEventDescribe(t *testing.T) {
+	want := "mallory was added to tools (admin) by alice at 2024-06-01T13:00:00Z"
+	if got := wantAuditEvents[1].Describe(); got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
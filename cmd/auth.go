@@ -0,0 +1,354 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// appJWTLifetime is below the 10 minutes GitHub accepts at most.
+	appJWTLifetime = 9 * time.Minute
+	// appClockSkew backdates the JWT in case the local clock is ahead.
+	appClockSkew = time.Minute
+	// installationTokenRefresh renews installation tokens this long before
+	// they expire, so a long export never sends an expired token.
+	installationTokenRefresh = 5 * time.Minute
+)
+
+// tokenSource returns the credentials used for the requests about
+// organization: a GitHub App installation token when an app is configured,
+// the token found by discoverToken otherwise.
+func tokenSource(ctx context.Context, organization string) oauth2.TokenSource {
+	if viper.GetString("app-id") != "" {
+		return appTokenSources.get(organization)
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: configuredToken()})
+}
+
+var (
+	tokenOnce sync.Once
+	token     string
+)
+
+// configuredToken discovers the token on first use and reports its source.
+func configuredToken() string {
+	tokenOnce.Do(func() {
+		var source string
+		token, source = discoverToken(endpointHost())
+		if token == "" {
+			log.Printf("No GitHub token found for %s, sending unauthenticated requests", endpointHost())
+			return
+		}
+		log.Printf("Token: %s", source)
+	})
+	return token
+}
+
+// endpointHost returns the host of the configured endpoint.
+func endpointHost() string {
+	endpoint := viper.GetString("endpoint")
+	if parsed, err := url.Parse(endpoint); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	if endpoint != "" {
+		return endpoint
+	}
+	return "github.com"
+}
+
+// discoverToken returns the first token found for host, in order, from:
+//
+//   - the --token flag
+//   - GH_TOKEN or GITHUB_TOKEN for github.com and GHE.com, GH_ENTERPRISE_TOKEN
+//     or GITHUB_ENTERPRISE_TOKEN for GitHub Enterprise Server
+//   - token in the config file
+//   - the gh CLI login of host
+//   - the output of credential-command
+//
+// It also returns a description of the source, which never includes the token.
+func discoverToken(host string) (string, string) {
+	if rootCmd.PersistentFlags().Changed("token") {
+		return viper.GetString("token"), "--token flag"
+	}
+
+	envVars := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	if !isGitHubCloud(host) {
+		envVars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, name := range envVars {
+		if value := os.Getenv(name); value != "" {
+			return value, name + " environment variable"
+		}
+	}
+
+	if viper.InConfig("token") && viper.GetString("token") != "" {
+		return viper.GetString("token"), "token in " + viper.ConfigFileUsed()
+	}
+
+	if value, source := ghCLIToken(host); value != "" {
+		return value, source
+	}
+
+	if command := viper.GetString("credential-command"); command != "" {
+		value, err := runCredentialCommand(command, host)
+		if err != nil {
+			log.Printf("Credential command failed: %v", err)
+		} else if value != "" {
+			return value, "credential command"
+		}
+	}
+
+	return "", ""
+}
+
+// isGitHubCloud reports whether host is github.com or a GHE.com subdomain,
+// whose tokens gh reads from GH_TOKEN rather than GH_ENTERPRISE_TOKEN.
+func isGitHubCloud(host string) bool {
+	host = strings.ToLower(host)
+	return host == "github.com" || host == "api.github.com" || strings.HasSuffix(host, ".ghe.com")
+}
+
+// ghHostsPath returns the path of the gh CLI hosts.yml.
+func ghHostsPath() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, "hosts.yml")
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh", "hosts.yml")
+	}
+	if dir := os.Getenv("AppData"); runtime.GOOS == "windows" && dir != "" {
+		return filepath.Join(dir, "GitHub CLI", "hosts.yml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gh", "hosts.yml")
+}
+
+// ghCLIToken returns the token gh is logged in with for host. Recent gh
+// versions keep it in the system keyring instead of hosts.yml, so when
+// hosts.yml has none, gh itself is asked for it.
+func ghCLIToken(host string) (string, string) {
+	path := ghHostsPath()
+	if data, err := os.ReadFile(path); err == nil {
+		var hosts map[string]struct {
+			OAuthToken string `yaml:"oauth_token"`
+		}
+		if err := yaml.Unmarshal(data, &hosts); err == nil {
+			for name, entry := range hosts {
+				if strings.EqualFold(name, host) && entry.OAuthToken != "" {
+					return entry.OAuthToken, path
+				}
+			}
+		}
+	}
+
+	gh, err := exec.LookPath("gh")
+	if err != nil {
+		return "", ""
+	}
+	out, err := exec.Command(gh, "auth", "token", "--hostname", host).Output()
+	if err != nil {
+		return "", ""
+	}
+	if value := strings.TrimSpace(string(out)); value != "" {
+		return value, "gh auth token"
+	}
+	return "", ""
+}
+
+// runCredentialCommand runs command with the shell and returns the first line
+// of its output. The host is passed in GH_AAC_HOST.
+func runCredentialCommand(command string, host string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	cmd := exec.Command(shell, flag, command)
+	cmd.Env = append(os.Environ(), "GH_AAC_HOST="+host)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// installationTokenSources keeps one refreshing installation token source per
+// organization, shared by every client of the process.
+type installationTokenSources struct {
+	mu      sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+var appTokenSources = &installationTokenSources{sources: make(map[string]oauth2.TokenSource)}
+
+func (s *installationTokenSources) get(organization string) oauth2.TokenSource {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(organization)
+	if source, ok := s.sources[key]; ok {
+		return source
+	}
+	source := oauth2.ReuseTokenSourceWithExpiry(nil, &installationTokenSource{
+		appID:          viper.GetString("app-id"),
+		privateKeyPath: viper.GetString("app-private-key"),
+		organization:   organization,
+	}, installationTokenRefresh)
+	s.sources[key] = source
+	return source
+}
+
+// installationTokenSource exchanges a GitHub App JWT for a token of the
+// installation of the app in an organization.
+type installationTokenSource struct {
+	appID          string
+	privateKeyPath string
+	organization   string
+
+	// installationID is looked up on the first token request.
+	installationID int64
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	if s.organization == "" {
+		return nil, fmt.Errorf("GitHub App authentication needs an organization")
+	}
+
+	key, err := loadAppPrivateKey(s.privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	jwt, err := signAppJWT(s.appID, key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// The app endpoints are authenticated with the JWT itself.
+	client := &http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: jwt}),
+		Base:   newRateLimitTransport(nil, viper.GetInt("max-retries")),
+	}}
+	ctx := context.Background()
+
+	if s.installationID == 0 {
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+		if err := restGet(ctx, client, fmt.Sprintf("orgs/%s/installation", s.organization), &installation); err != nil {
+			return nil, fmt.Errorf("finding the installation of GitHub App %s in %s: %w", s.appID, s.organization, err)
+		}
+		s.installationID = installation.ID
+	}
+
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	_, err = restRequest(ctx, client, http.MethodPost, fmt.Sprintf("app/installations/%d/access_tokens", s.installationID), nil, &token)
+	if err != nil {
+		return nil, fmt.Errorf("creating an installation token for %s: %w", s.organization, err)
+	}
+
+	return &oauth2.Token{AccessToken: token.Token, Expiry: token.ExpiresAt}, nil
+}
+
+// loadAppPrivateKey reads the PEM private key downloaded from the settings of
+// the GitHub App.
+func loadAppPrivateKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		return nil, fmt.Errorf("app-private-key is required with app-id")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM private key", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an RSA private key", path)
+	}
+	return key, nil
+}
+
+// signAppJWT returns the RS256 JWT that authenticates as the GitHub App.
+func signAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-appClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
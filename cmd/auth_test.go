@@ -0,0 +1,258 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+// useGitHubApp generates an app key, makes f require app authentication and
+// configures the app credentials for the duration of the test.
+func useGitHubApp(t *testing.T, f *fakeGitHub) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "app.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f.appKey = &key.PublicKey
+
+	previous := appTokenSources
+	appTokenSources = &installationTokenSources{sources: make(map[string]oauth2.TokenSource)}
+	viper.Set("app-id", "12345")
+	viper.Set("app-private-key", path)
+	t.Cleanup(func() {
+		appTokenSources = previous
+		viper.Set("app-id", "")
+		viper.Set("app-private-key", "")
+	})
+}
+
+func TestSignAppJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	jwt, err := signAppJWT("12345", key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeGitHub{appKey: &key.PublicKey}
+	request := httptest.NewRequest(http.MethodPost, "/app/installations/1/access_tokens", nil)
+	request.Header.Set("Authorization", "Bearer "+jwt)
+	if !f.validJWT(request) {
+		t.Fatal("the JWT signature does not verify with the app public key")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(jwt, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		IssuedAt  int64  `json:"iat"`
+		ExpiresAt int64  `json:"exp"`
+		Issuer    string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != "12345" {
+		t.Errorf("iss = %q, want the app ID", claims.Issuer)
+	}
+	if claims.IssuedAt >= now.Unix() || claims.ExpiresAt-claims.IssuedAt > int64((10*time.Minute).Seconds()) {
+		t.Errorf("iat = %d, exp = %d: want a backdated iat and at most 10 minutes of validity", claims.IssuedAt, claims.ExpiresAt)
+	}
+}
+
+func TestExportAsGitHubApp(t *testing.T) {
+	umbrella := loadFixture(t, "acme.yaml")
+	umbrella.Organization.Login = "umbrella"
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"), umbrella)
+	f.installations["acme"] = 1
+	f.installations["umbrella"] = 2
+	useGitHubApp(t, f)
+
+	ctx := context.Background()
+	for _, org := range []string{"acme", "umbrella"} {
+		provider, err := newGitHubProvider(ctx, org)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := exportOrganization(ctx, newWorkerPool(4), provider, org, nil); err != nil {
+			t.Fatalf("exporting %s as a GitHub App: %v", org, err)
+		}
+	}
+
+	// Tokens are reused for the whole export of each organization.
+	for _, path := range []string{"POST app/installations/1/access_tokens", "POST app/installations/2/access_tokens"} {
+		if got := f.count(path); got != 1 {
+			t.Errorf("%s served %d times, want 1", path, got)
+		}
+	}
+}
+
+func TestInstallationTokenRefreshedBeforeExpiry(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.installations["acme"] = 1
+	f.tokenTTL = installationTokenRefresh / 2
+	useGitHubApp(t, f)
+
+	source := tokenSource(context.Background(), "acme")
+	first, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AccessToken == second.AccessToken {
+		t.Error("a token about to expire was reused")
+	}
+	if got := f.count("GET orgs/acme/installation"); got != 1 {
+		t.Errorf("the installation was looked up %d times, want 1", got)
+	}
+}
+
+func TestInstallationTokenWithoutInstallation(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	useGitHubApp(t, f)
+
+	_, err := tokenSource(context.Background(), "acme").Token()
+	if err == nil || !strings.Contains(err.Error(), "installation") {
+		t.Fatalf("error = %v, want a missing installation error", err)
+	}
+}
+
+func TestDiscoverToken(t *testing.T) {
+	ghConfig := t.TempDir()
+	hosts := "github.com:\n    user: octocat\n    oauth_token: gho_hosts\nghe.example.com:\n    oauth_token: gho_enterprise\n"
+	if err := os.WriteFile(filepath.Join(ghConfig, "hosts.yml"), []byte(hosts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		env        map[string]string
+		command    string
+		wantToken  string
+		wantSource string
+	}{
+		{
+			name:       "GH_TOKEN before GITHUB_TOKEN",
+			host:       "github.com",
+			env:        map[string]string{"GH_TOKEN": "gh", "GITHUB_TOKEN": "github"},
+			wantToken:  "gh",
+			wantSource: "GH_TOKEN environment variable",
+		},
+		{
+			name:       "enterprise token for GHES",
+			host:       "ghe.example.com",
+			env:        map[string]string{"GH_TOKEN": "gh", "GH_ENTERPRISE_TOKEN": "enterprise"},
+			wantToken:  "enterprise",
+			wantSource: "GH_ENTERPRISE_TOKEN environment variable",
+		},
+		{
+			name:       "GH_TOKEN for GHE.com",
+			host:       "acme.ghe.com",
+			env:        map[string]string{"GH_TOKEN": "gh", "GH_ENTERPRISE_TOKEN": "enterprise"},
+			wantToken:  "gh",
+			wantSource: "GH_TOKEN environment variable",
+		},
+		{
+			name:       "gh hosts.yml of the host",
+			host:       "ghe.example.com",
+			env:        map[string]string{"GH_TOKEN": "gh"},
+			wantToken:  "gho_enterprise",
+			wantSource: filepath.Join(ghConfig, "hosts.yml"),
+		},
+		{
+			name:       "credential command",
+			host:       "other.example.com",
+			command:    `echo "token-for-$GH_AAC_HOST"`,
+			wantToken:  "token-for-other.example.com",
+			wantSource: "credential command",
+		},
+		{
+			name: "nothing found",
+			host: "other.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"GH_TOKEN", "GITHUB_TOKEN", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"} {
+				t.Setenv(name, tt.env[name])
+			}
+			t.Setenv("GH_CONFIG_DIR", ghConfig)
+			// Keep a gh CLI installed on the machine out of the test.
+			t.Setenv("PATH", shellOnlyPath(t))
+			viper.Set("credential-command", tt.command)
+			t.Cleanup(func() { viper.Set("credential-command", "") })
+
+			token, source := discoverToken(tt.host)
+			if token != tt.wantToken || source != tt.wantSource {
+				t.Errorf("discoverToken(%q) = %q, %q; want %q, %q", tt.host, token, source, tt.wantToken, tt.wantSource)
+			}
+		})
+	}
+}
+
+// shellOnlyPath returns a PATH where sh is the only command.
+func shellOnlyPath(t *testing.T) string {
+	t.Helper()
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available")
+	}
+	dir := t.TempDir()
+	if err := os.Symlink(sh, filepath.Join(dir, "sh")); err != nil {
+		t.Skip(err)
+	}
+	return dir
+}
@@ -0,0 +1,235 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// exportCache is the result of the previous export of an organization, used
+// to skip the entities that did not change since then.
+type exportCache struct {
+	Config AccessConfig `json:"config"`
+	// RepoUpdatedAt and TeamUpdatedAt map repository names and team slugs to
+	// their updatedAt at the time of the previous export.
+	RepoUpdatedAt map[string]string `json:"repoUpdatedAt"`
+	TeamUpdatedAt map[string]string `json:"teamUpdatedAt"`
+}
+
+// unchangedRepo reports whether the cached data of repo can be reused.
+func (c *exportCache) unchangedRepo(repo RepositoryInfo) bool {
+	return c != nil && repo.UpdatedAt != "" && c.RepoUpdatedAt[repo.Name] == repo.UpdatedAt
+}
+
+// unchangedTeam reports whether the cached data of team can be reused.
+func (c *exportCache) unchangedTeam(team TeamInfo) bool {
+	return c != nil && team.UpdatedAt != "" && c.TeamUpdatedAt[team.Slug] == team.UpdatedAt
+}
+
+// cacheDir returns the cache directory of the current endpoint.
+func cacheDir() string {
+	dir := viper.GetString("cache-dir")
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(userCacheDir, "gh-aac")
+	}
+
+	host := "github.com"
+	if parsed, err := url.Parse(URLGRAPHQL); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	return filepath.Join(dir, strings.ReplaceAll(host, ":", "_"))
+}
+
+func exportCachePath(organization string) string {
+	dir := cacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, strings.ToLower(organization)+".json")
+}
+
+// loadExportCache returns the cache of the previous export of organization,
+// or nil if there is none.
+func loadExportCache(organization string) *exportCache {
+	path := exportCachePath(organization)
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cache exportCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil
+	}
+	return &cache
+}
+
+// saveExportCache stores config as the cache of organization.
+func saveExportCache(organization string, config *AccessConfig) error {
+	path := exportCachePath(organization)
+	if path == "" {
+		return nil
+	}
+
+	cache := exportCache{
+		Config:        *config,
+		RepoUpdatedAt: make(map[string]string),
+		TeamUpdatedAt: make(map[string]string),
+	}
+	for _, repo := range config.Repositories {
+		cache.RepoUpdatedAt[repo.Name] = repo.UpdatedAt
+	}
+	for _, team := range config.Teams {
+		cache.TeamUpdatedAt[team.Slug] = team.UpdatedAt
+	}
+
+	return writeCacheFile(path, cache)
+}
+
+func writeCacheFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// etagEntry is a cached REST response.
+type etagEntry struct {
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+	Next string `json:"next,omitempty"`
+}
+
+// etagCache makes REST GET requests conditional. Responses answered with
+// 304 Not Modified do not count against the rate limit.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+// restETags is nil unless enabled by the command, as export does.
+var restETags *etagCache
+
+func (c *etagCache) get(url string) (etagEntry, bool) {
+	if c == nil {
+		return etagEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	return entry, ok
+}
+
+// put caches the response of rawURL. The delivery URLs of webhooks can carry
+// secrets in their path or query, so only their scheme and host are kept, as
+// in the export, and webhooks that cannot be redacted are not cached.
+func (c *etagCache) put(rawURL string, entry etagEntry) {
+	if c == nil || entry.ETag == "" {
+		return
+	}
+	if parsed, err := url.Parse(rawURL); err != nil || strings.HasSuffix(parsed.Path, "/hooks") {
+		body, ok := redactWebhooks(entry.Body)
+		if !ok {
+			return
+		}
+		entry.Body = body
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[rawURL] = entry
+}
+
+// redactWebhooks returns a REST list of hooks with the delivery URLs reduced
+// to their scheme and host, and without secrets.
+func redactWebhooks(body []byte) ([]byte, bool) {
+	var hooks []map[string]interface{}
+	if err := json.Unmarshal(body, &hooks); err != nil {
+		return nil, false
+	}
+	for _, hook := range hooks {
+		config, _ := hook["config"].(map[string]interface{})
+		if config == nil {
+			continue
+		}
+		redacted := ""
+		if rawURL, ok := config["url"].(string); ok {
+			if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+				redacted = parsed.Scheme + "://" + parsed.Host
+			}
+		}
+		config["url"] = redacted
+		delete(config, "secret")
+	}
+	data, err := json.Marshal(hooks)
+	return data, err == nil
+}
+
+func etagCachePath() string {
+	dir := cacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "etags.json")
+}
+
+// loadETagCache enables conditional requests with the cache of the previous
+// exports. GitHub answers them from the cache only when nothing changed.
+func loadETagCache() {
+	restETags = &etagCache{entries: make(map[string]etagEntry)}
+
+	path := etagCachePath()
+	if path == "" {
+		return
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &restETags.entries)
+	}
+}
+
+func saveETagCache() error {
+	path := etagCachePath()
+	if path == "" || restETags == nil {
+		return nil
+	}
+
+	restETags.mu.Lock()
+	defer restETags.mu.Unlock()
+	return writeCacheFile(path, restETags.entries)
+}
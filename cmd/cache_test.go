@@ -0,0 +1,81 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestETagCacheRedactsWebhooks(t *testing.T) {
+	cache := &etagCache{entries: make(map[string]etagEntry)}
+	hooks := `[{"id": 1, "url": "https://api.github.com/orgs/acme/hooks/1", "config": {"url": "https://hooks.example.com/services/T000/B000/XXXX?token=secret", "secret": "********", "content_type": "json"}},
+{"id": 2, "config": {"url": "not a url/secret"}}]`
+
+	hooksURL := "https://api.github.com/orgs/acme/hooks?per_page=100"
+	cache.put(hooksURL, etagEntry{ETag: `"abc"`, Body: []byte(hooks)})
+	entry, ok := cache.get(hooksURL)
+	if !ok {
+		t.Fatal("the webhooks were not cached")
+	}
+	if strings.Contains(string(entry.Body), "secret") || strings.Contains(string(entry.Body), "T000") {
+		t.Errorf("the cached webhooks keep secrets: %s", entry.Body)
+	}
+	var cached []restWebhook
+	if err := json.Unmarshal(entry.Body, &cached); err != nil {
+		t.Fatal(err)
+	}
+	if host := cached[0].toWebhookInfo("").Host; host != "hooks.example.com" {
+		t.Errorf("host of the cached webhook = %q, want hooks.example.com", host)
+	}
+	if host := cached[1].toWebhookInfo("").Host; host != redactedHost {
+		t.Errorf("host of the cached webhook = %q, want %s", host, redactedHost)
+	}
+
+	cache.put("https://api.github.com/repos/acme/api/hooks", etagEntry{ETag: `"def"`, Body: []byte("not json")})
+	if _, ok := cache.get("https://api.github.com/repos/acme/api/hooks"); ok {
+		t.Error("webhooks that cannot be redacted were cached")
+	}
+
+	members := `[{"login": "alice"}]`
+	cache.put("https://api.github.com/orgs/acme/members", etagEntry{ETag: `"ghi"`, Body: []byte(members)})
+	if entry, ok := cache.get("https://api.github.com/orgs/acme/members"); !ok || string(entry.Body) != members {
+		t.Errorf("members entry = %+v, %v, want the body as is", entry, ok)
+	}
+}
+
+func TestUpdatedAtIsNotExported(t *testing.T) {
+	config := &AccessConfig{
+		Repositories: []RepositoryInfo{{Name: "api", UpdatedAt: "2024-06-01T00:00:00Z"}},
+		Teams:        []TeamInfo{{Slug: "backend", UpdatedAt: "2024-06-01T00:00:00Z"}},
+	}
+	for _, format := range []string{"json", "yaml"} {
+		data, err := marshalConfig(config, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(strings.ToLower(string(data)), "updatedat") {
+			t.Errorf("the %s export has updatedAt:\n%s", format, data)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// maxDormantDays is the longest window of the dormant command, as GitHub
+// only returns up to a year of contributions at once.
+const maxDormantDays = 365
+
+// dormantCmd represents the dormant command
+var dormantCmd = &cobra.Command{
+	Use:   "dormant",
+	Short: "Report the organization members inactive for more than N days",
+	Long: `Report the organization members inactive for more than N days.
+
+The last activity of every member is taken from:
+
+  - their contributions to the organization (commits, issues, pull requests
+    and reviews),
+  - the last use of their SAML SSO authorized credentials, where available,
+  - the organization audit log, where available (GitHub Enterprise Cloud).
+
+The audit log costs one REST request per member without contributions or
+credential use in the window, filtered by actor and limited to their latest
+event, so large organizations with many inactive members spend that many
+requests of the rate limit.
+
+Members with no activity in the last --days days are reported with every
+team and repository permission they still hold according to the access
+configuration file, including the permissions of the parent teams of their
+teams.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		days, _ := cmd.Flags().GetInt("days")
+		format, _ := cmd.Flags().GetString("output")
+		if days < 1 || days > maxDormantDays {
+			log.Fatalf("Invalid --days %d: use 1 to %d", days, maxDormantDays)
+		}
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		organization, err := targetOrganization()
+		if err != nil {
+			if config.Organization.Login == "" {
+				log.Fatal(err)
+			}
+			organization = config.Organization.Login
+		}
+
+		ctx := context.Background()
+		since := time.Now().AddDate(0, 0, -days)
+		activity, err := mustGitHubProvider(ctx, organization).MemberActivity(ctx, organization, since)
+		if err != nil {
+			log.Fatalf("Failed to get the activity of the members of %s: %v", organization, err)
+		}
+
+		dormant := dormantMembers(config, activity)
+		if format == "json" {
+			data, err := json.MarshalIndent(dormant, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(data))
+			return
+		}
+
+		for _, member := range dormant {
+			fmt.Printf("%s (%s): no activity in the last %d days\n", member.Login, member.Role, days)
+			if len(member.Teams) > 0 {
+				fmt.Printf("  teams: %s\n", strings.Join(member.Teams, ", "))
+			}
+			for _, grant := range member.Grants {
+				fmt.Printf("  %s\n", grant.Describe())
+			}
+		}
+		log.Printf("%d of %d members are dormant", len(dormant), len(activity))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dormantCmd)
+	dormantCmd.Flags().Int("days", 90, "Days without activity after which a member is dormant")
+	dormantCmd.Flags().String("output", "text", "Output format: text or json")
+}
+
+// MemberActivity is the last activity of an organization member.
+type MemberActivity struct {
+	Login string
+	Role  string
+	// LastActive is zero when no activity was found since the start of the
+	// window, and Source tells where it was found otherwise.
+	LastActive time.Time
+	Source     string
+}
+
+// DormantMember is a member without activity and the access it still holds.
+type DormantMember struct {
+	Login  string      `json:"login"`
+	Role   string      `json:"role"`
+	Teams  []string    `json:"teams,omitempty"`
+	Grants []RepoGrant `json:"grants,omitempty"`
+}
+
+// RepoGrant is a permission on a repository, given to the user directly or
+// through a team.
+type RepoGrant struct {
+	Repo   string `json:"repo"`
+	Access string `json:"access"`
+	// Team is empty for direct permissions.
+	Team string `json:"team,omitempty"`
+}
+
+// Describe returns a one line description of the grant.
+func (g RepoGrant) Describe() string {
+	if g.Team == "" {
+		return fmt.Sprintf("%s: %s directly", g.Repo, g.Access)
+	}
+	return fmt.Sprintf("%s: %s through team %s", g.Repo, g.Access, g.Team)
+}
+
+// dormantMembers returns the members without activity with their teams and
+// repository permissions in config.
+func dormantMembers(config *AccessConfig, activity []MemberActivity) []DormantMember {
+	var dormant []DormantMember
+	for _, member := range activity {
+		if !member.LastActive.IsZero() {
+			continue
+		}
+
+		teams := userTeams(config, member.Login)
+		var grants []RepoGrant
+		for _, permission := range config.Permissions.Users {
+			if strings.EqualFold(permission.Login, member.Login) {
+				grants = append(grants, RepoGrant{Repo: permission.Repo, Access: permission.Access})
+			}
+		}
+		for _, permission := range config.Permissions.Teams {
+			for _, team := range teams {
+				if sameTeam(config, permission.Slug, team) {
+					grants = append(grants, RepoGrant{Repo: permission.Repo, Access: permission.Access, Team: team})
+				}
+			}
+		}
+		sort.SliceStable(grants, func(i, j int) bool {
+			return strings.ToLower(grants[i].Repo) < strings.ToLower(grants[j].Repo)
+		})
+
+		dormant = append(dormant, DormantMember{Login: member.Login, Role: member.Role, Teams: teams, Grants: grants})
+	}
+	return dormant
+}
+
+// userTeams returns the slugs of the teams of login, followed by the parent
+// teams they inherit permissions from.
+func userTeams(config *AccessConfig, login string) []string {
+	var teams []string
+	for _, chain := range teamChains(config, login) {
+		teams = append(teams, chain[len(chain)-1])
+	}
+	return teams
+}
+
+type MemberActivityQuery struct {
+	RateLimit    RateLimitInfo
+	Organization struct {
+		MembersWithRole struct {
+			Edges []struct {
+				Role githubv4.String
+				Node struct {
+					Login                   githubv4.String
+					ContributionsCollection struct {
+						ContributionCalendar struct {
+							Weeks []struct {
+								ContributionDays []struct {
+									Date              githubv4.String
+									ContributionCount githubv4.Int
+								}
+							}
+						}
+					} `graphql:"contributionsCollection(organizationID: $orgID, from: $from)"`
+				}
+			}
+			PageInfo struct {
+				EndCursor   githubv4.String
+				HasNextPage bool
+			}
+		} `graphql:"membersWithRole(first: 25, after: $afterCursor)"`
+	} `graphql:"organization(login: $org)"`
+}
+
+// getMemberActivity returns the members of the organization with their last
+// activity since the given time. The audit log and the credential
+// authorizations are skipped when the organization does not have them.
+// Members with activity in their contributions or credentials are not looked
+// up in the audit log, so their last activity may be older than their latest
+// audit log event.
+func getMemberActivity(ctx context.Context, client *githubv4.Client, httpClient *http.Client, organization string, since time.Time) ([]MemberActivity, error) {
+	orgInfo, err := getOrganizationInfo(ctx, client, organization)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []MemberActivity
+	index := make(map[string]int)
+	seen := func(login string, at time.Time, source string) {
+		i, ok := index[strings.ToLower(login)]
+		if ok && !at.Before(since) && at.After(members[i].LastActive) {
+			members[i].LastActive = at
+			members[i].Source = source
+		}
+	}
+
+	var afterCursor *githubv4.String
+	for {
+		var query MemberActivityQuery
+		variables := map[string]interface{}{
+			"org":         githubv4.String(organization),
+			"orgID":       githubv4.ID(orgInfo.ID),
+			"from":        githubv4.DateTime{Time: since},
+			"afterCursor": afterCursor,
+		}
+		if err := client.Query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("error ejecutando la consulta: %v", err)
+		}
+
+		for _, edge := range query.Organization.MembersWithRole.Edges {
+			login := string(edge.Node.Login)
+			index[strings.ToLower(login)] = len(members)
+			members = append(members, MemberActivity{Login: login, Role: string(edge.Role)})
+			for _, week := range edge.Node.ContributionsCollection.ContributionCalendar.Weeks {
+				for _, day := range week.ContributionDays {
+					date, err := time.Parse("2006-01-02", string(day.Date))
+					if err == nil && day.ContributionCount > 0 {
+						seen(login, date, "contributions")
+					}
+				}
+			}
+		}
+
+		if !query.Organization.MembersWithRole.PageInfo.HasNextPage {
+			break
+		}
+		afterCursor = &query.Organization.MembersWithRole.PageInfo.EndCursor
+	}
+
+	authorizations, err := restGetAll[struct {
+		Login                string     `json:"login"`
+		CredentialAccessedAt *time.Time `json:"credential_accessed_at"`
+	}](ctx, httpClient, fmt.Sprintf("orgs/%s/credential-authorizations", organization))
+	if skipUnavailable(err, "the read:org scope as an organization owner") {
+		log.Printf("%s has no SAML SSO credential authorizations, skipping them", organization)
+	} else if err != nil {
+		return nil, fmt.Errorf("credential authorizations: %w", err)
+	}
+	for _, authorization := range authorizations {
+		if authorization.CredentialAccessedAt != nil {
+			seen(authorization.Login, *authorization.CredentialAccessedAt, "credential")
+		}
+	}
+
+	// The audit log is only read for the members still without activity, one
+	// request for the latest event of each, instead of paging through every
+	// event of the organization.
+	for i := range members {
+		if !members[i].LastActive.IsZero() {
+			continue
+		}
+		phrase := fmt.Sprintf("actor:%s created:>=%s", members[i].Login, since.UTC().Format("2006-01-02"))
+		var entries []map[string]interface{}
+		err := restGet(ctx, httpClient, fmt.Sprintf("orgs/%s/audit-log?include=all&order=desc&per_page=1&phrase=%s", organization, url.QueryEscape(phrase)), &entries)
+		if skipUnavailable(err, "the read:audit_log scope as an organization owner") {
+			log.Printf("The audit log of %s is not available, skipping it: %v", organization, err)
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("audit log: %w", err)
+		}
+		for _, entry := range entries {
+			if at, ok := auditTime(entry["@timestamp"]); ok {
+				seen(auditString(entry, "actor"), at, "audit log")
+			}
+		}
+	}
+
+	return members, nil
+}
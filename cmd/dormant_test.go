@@ -0,0 +1,115 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetMemberActivity(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	since := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	f.contributions["bob"] = "2023-03-10"
+	f.contributions["carol"] = "2023-01-10"
+	f.rest["orgs/acme/audit-log"] = []interface{}{
+		map[string]interface{}{"action": "repo.download_zip", "actor": "carol", "@timestamp": float64(time.Date(2023, 3, 5, 0, 0, 0, 0, time.UTC).UnixMilli())},
+		map[string]interface{}{"action": "repo.download_zip", "actor": "carol", "@timestamp": float64(time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC).UnixMilli())},
+		map[string]interface{}{"action": "repo.download_zip", "actor": "bob", "@timestamp": float64(time.Date(2023, 3, 16, 0, 0, 0, 0, time.UTC).UnixMilli())},
+	}
+	f.rest["orgs/acme/credential-authorizations"] = []interface{}{
+		map[string]interface{}{"login": "dave", "credential_accessed_at": "2023-03-20T00:00:00Z"},
+		map[string]interface{}{"login": "erin", "credential_accessed_at": "2023-02-01T00:00:00Z"},
+		map[string]interface{}{"login": "frank", "credential_accessed_at": nil},
+	}
+
+	activity, err := f.provider().MemberActivity(context.Background(), "acme", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, member := range activity {
+		got[member.Login] = member.Source
+	}
+	want := map[string]string{"alice": "", "bob": "contributions", "carol": "audit log", "dave": "credential", "erin": "", "frank": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %v, want %v", got, want)
+	}
+	if got := activity[2].LastActive; !got.Equal(time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("last activity of carol = %v, want her latest audit log event", got)
+	}
+	// Only the members without contributions or credential use are looked up.
+	if got := f.count("GET orgs/acme/audit-log"); got != 4 {
+		t.Errorf("audit log requests = %d, want 4", got)
+	}
+
+	// Organizations without the audit log or SAML SSO only lose that source.
+	f.forbidden = []string{"orgs/acme/audit-log", "orgs/acme/credential-authorizations"}
+	activity, err = f.provider().MemberActivity(context.Background(), "acme", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activity) != 6 || activity[1].Source != "contributions" || !activity[2].LastActive.IsZero() {
+		t.Errorf("activity without audit log = %+v", activity)
+	}
+}
+
+func TestDormantMembers(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	at := time.Date(2023, 3, 10, 0, 0, 0, 0, time.UTC)
+	activity := []MemberActivity{
+		{Login: "alice", Role: "ADMIN", LastActive: at, Source: "contributions"},
+		{Login: "erin", Role: "MEMBER"},
+		{Login: "frank", Role: "MEMBER"},
+	}
+
+	want := []DormantMember{
+		{Login: "erin", Role: "MEMBER", Teams: []string{"platform", "engineering"}, Grants: []RepoGrant{
+			{Repo: "api", Access: "WRITE", Team: "engineering"},
+			{Repo: "infra", Access: "ADMIN"},
+			{Repo: "infra", Access: "READ", Team: "engineering"},
+			{Repo: "infra", Access: "ADMIN", Team: "platform"},
+			{Repo: "web", Access: "WRITE", Team: "engineering"},
+		}},
+		{Login: "frank", Role: "MEMBER", Teams: []string{"security"}, Grants: []RepoGrant{
+			{Repo: "api", Access: "READ", Team: "security"},
+			{Repo: "infra", Access: "READ", Team: "security"},
+			{Repo: "web", Access: "READ", Team: "security"},
+		}},
+	}
+	if got := dormantMembers(config, activity); !reflect.DeepEqual(got, want) {
+		t.Errorf("dormant members:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestUserTeamsIncludesParentTeams(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+
+	if got, want := userTeams(config, "bob"), []string{"backend", "engineering"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("teams of bob = %v, want %v", got, want)
+	}
+	if got := userTeams(config, "outsider"); got != nil {
+		t.Errorf("teams of outsider = %v", got)
+	}
+}
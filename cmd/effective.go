@@ -0,0 +1,425 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Kinds of grants behind an effective permission.
+const (
+	grantOwner  = "owner"
+	grantDirect = "direct"
+	grantTeam   = "team"
+	grantBase   = "base"
+)
+
+// effectiveCmd represents the effective command
+var effectiveCmd = &cobra.Command{
+	Use:   "effective",
+	Short: "Print the effective permission of every user on every repository",
+	Long: `Print the effective permission of every user on every repository.
+
+The effective permission of a user on a repository is the highest of:
+
+  - ADMIN, for the owners of the organization,
+  - the permission granted to the user directly,
+  - the permissions of every team of the user and of every parent team of
+    those teams, which child teams inherit,
+  - the base permission of the organization, for its members.
+
+Each permission is printed with the chain of grants that produce it, the
+highest first. --user and --repo restrict the output to a user or a
+repository.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		user, _ := cmd.Flags().GetString("user")
+		repo, _ := cmd.Flags().GetString("repo")
+		format, _ := cmd.Flags().GetString("output")
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		if user != "" {
+			user = resolveUser(config.Organization.Login, user)
+		}
+
+		var permissions []EffectivePermission
+		switch {
+		case user != "":
+			for _, permission := range resolveUserPermissions(config, user) {
+				if repo == "" || strings.EqualFold(permission.Repo, repo) {
+					permissions = append(permissions, permission)
+				}
+			}
+		case repo != "":
+			permissions = resolveRepoPermissions(config, repo)
+		default:
+			permissions = resolveEffectivePermissions(config)
+		}
+
+		if format == "json" {
+			data, err := json.MarshalIndent(permissions, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(data))
+			return
+		}
+		for _, permission := range permissions {
+			fmt.Printf("%s on %s: %s\n", permission.Login, permission.Repo, permission.Access)
+			for _, grant := range permission.Grants {
+				fmt.Printf("  %s\n", grant.Describe())
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(effectiveCmd)
+	effectiveCmd.Flags().String("user", "", "Only print the permissions of this user, by login or corporate identity (NameID, SCIM username or email)")
+	effectiveCmd.Flags().String("repo", "", "Only print the permissions on this repository")
+	effectiveCmd.Flags().String("output", "text", "Output format: text or json")
+}
+
+// EffectivePermission is the access of a user to a repository with the
+// grants that produce it, the highest first.
+type EffectivePermission struct {
+	Login  string            `json:"login"`
+	Repo   string            `json:"repo"`
+	Access string            `json:"access"`
+	Grants []PermissionGrant `json:"grants"`
+}
+
+// PermissionGrant is one of the grants behind an effective permission.
+type PermissionGrant struct {
+	Access string `json:"access"`
+	Kind   string `json:"kind"`
+	// Teams is the chain of a team grant, from the team the user is a
+	// member of up to the parent team holding the permission.
+	Teams []string `json:"teams,omitempty"`
+}
+
+// Describe returns a one line description of the grant.
+func (g PermissionGrant) Describe() string {
+	switch g.Kind {
+	case grantOwner:
+		return fmt.Sprintf("%s as organization owner", g.Access)
+	case grantBase:
+		return fmt.Sprintf("%s as organization base permission", g.Access)
+	case grantTeam:
+		return fmt.Sprintf("%s through team %s", g.Access, strings.Join(g.Teams, " → "))
+	}
+	return fmt.Sprintf("%s granted directly", g.Access)
+}
+
+// resolveEffectivePermissions returns the effective permission of every
+// member and collaborator on every repository they have access to, sorted by
+// login and repository.
+func resolveEffectivePermissions(config *AccessConfig) []EffectivePermission {
+	index := newGrantIndex(config)
+	var permissions []EffectivePermission
+	for _, login := range index.logins {
+		permissions = append(permissions, index.userPermissions(login)...)
+	}
+	sortEffectivePermissions(permissions)
+	return permissions
+}
+
+// resolveUserPermissions returns the effective permissions of login, sorted
+// by repository. It is empty when login is neither a member nor a
+// collaborator.
+func resolveUserPermissions(config *AccessConfig, login string) []EffectivePermission {
+	index := newGrantIndex(config)
+	if login = index.login(login); login == "" {
+		return nil
+	}
+	permissions := index.userPermissions(login)
+	sortEffectivePermissions(permissions)
+	return permissions
+}
+
+// resolveRepoPermissions returns the effective permissions on repo, sorted
+// by login. It is empty when config has no repository or permission on repo.
+func resolveRepoPermissions(config *AccessConfig, repo string) []EffectivePermission {
+	index := newGrantIndex(config)
+	if repo = index.repo(repo); repo == "" {
+		return nil
+	}
+	var permissions []EffectivePermission
+	for _, login := range index.logins {
+		if permission, ok := index.permission(login, repo, index.teams.chains(login)); ok {
+			permissions = append(permissions, permission)
+		}
+	}
+	sortEffectivePermissions(permissions)
+	return permissions
+}
+
+func sortEffectivePermissions(permissions []EffectivePermission) {
+	sort.SliceStable(permissions, func(i, j int) bool {
+		if !strings.EqualFold(permissions[i].Login, permissions[j].Login) {
+			return strings.ToLower(permissions[i].Login) < strings.ToLower(permissions[j].Login)
+		}
+		return strings.ToLower(permissions[i].Repo) < strings.ToLower(permissions[j].Repo)
+	})
+}
+
+// grantKey is a lower cased login or team slug and repository.
+type grantKey struct {
+	grantee string
+	repo    string
+}
+
+// grantIndex holds the grants of an access configuration indexed by
+// repository and login or team, so that a permission is resolved without
+// scanning every grant.
+type grantIndex struct {
+	teams *teamGraph
+	// roles holds the organization role of every member by lower cased login.
+	roles map[string]string
+	// logins are the members followed by the outside collaborators, as
+	// written in the configuration.
+	logins []string
+	repos  []string
+	users  map[grantKey][]string
+	// teamGrants is keyed by the lower cased slug of the team.
+	teamGrants map[grantKey][]string
+	base       string
+}
+
+func newGrantIndex(config *AccessConfig) *grantIndex {
+	index := &grantIndex{
+		teams:      newTeamGraph(config),
+		roles:      make(map[string]string),
+		users:      make(map[grantKey][]string),
+		teamGrants: make(map[grantKey][]string),
+		base:       strings.ToUpper(config.Organization.DefaultRepositoryPermission),
+	}
+
+	for _, member := range config.Members {
+		if _, ok := index.roles[strings.ToLower(member.Login)]; !ok {
+			index.roles[strings.ToLower(member.Login)] = member.Role
+			index.logins = append(index.logins, member.Login)
+		}
+	}
+	// Outside collaborators only appear in the user permissions.
+	collaborators := make(map[string]bool)
+	for _, permission := range config.Permissions.Users {
+		key := strings.ToLower(permission.Login)
+		if _, member := index.roles[key]; !member && !collaborators[key] {
+			collaborators[key] = true
+			index.logins = append(index.logins, permission.Login)
+		}
+	}
+
+	repos := make(map[string]bool)
+	addRepo := func(repo string) {
+		if !repos[strings.ToLower(repo)] {
+			repos[strings.ToLower(repo)] = true
+			index.repos = append(index.repos, repo)
+		}
+	}
+	for _, repo := range config.Repositories {
+		addRepo(repo.Name)
+	}
+	for _, permission := range config.Permissions.Users {
+		addRepo(permission.Repo)
+		key := grantKey{strings.ToLower(permission.Login), strings.ToLower(permission.Repo)}
+		index.users[key] = append(index.users[key], permission.Access)
+	}
+	for _, permission := range config.Permissions.Teams {
+		addRepo(permission.Repo)
+		key := grantKey{index.teams.key(permission.Slug), strings.ToLower(permission.Repo)}
+		index.teamGrants[key] = append(index.teamGrants[key], permission.Access)
+	}
+	return index
+}
+
+// login returns login as written in the configuration, or "" when it is
+// neither a member nor a collaborator.
+func (x *grantIndex) login(login string) string {
+	for _, candidate := range x.logins {
+		if strings.EqualFold(candidate, login) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// repo returns repo as written in the configuration, or "" when the
+// configuration has no repository or permission on it.
+func (x *grantIndex) repo(repo string) string {
+	for _, candidate := range x.repos {
+		if strings.EqualFold(candidate, repo) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// userPermissions returns the effective permissions of login, unsorted.
+func (x *grantIndex) userPermissions(login string) []EffectivePermission {
+	chains := x.teams.chains(login)
+	var permissions []EffectivePermission
+	for _, repo := range x.repos {
+		if permission, ok := x.permission(login, repo, chains); ok {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// permission returns the effective permission of login on repo, given the
+// team chains of login. It reports false when login has no access to repo.
+func (x *grantIndex) permission(login string, repo string, chains [][]string) (EffectivePermission, bool) {
+	role, member := x.roles[strings.ToLower(login)]
+	repoKey := strings.ToLower(repo)
+
+	var grants []PermissionGrant
+	if strings.EqualFold(role, "ADMIN") {
+		grants = append(grants, PermissionGrant{Access: "ADMIN", Kind: grantOwner})
+	}
+	for _, access := range x.users[grantKey{strings.ToLower(login), repoKey}] {
+		grants = append(grants, PermissionGrant{Access: access, Kind: grantDirect})
+	}
+	for _, chain := range chains {
+		for _, access := range x.teamGrants[grantKey{strings.ToLower(chain[len(chain)-1]), repoKey}] {
+			grants = append(grants, PermissionGrant{Access: access, Kind: grantTeam, Teams: chain})
+		}
+	}
+	if member && permissionRank(x.base) > 0 {
+		grants = append(grants, PermissionGrant{Access: x.base, Kind: grantBase})
+	}
+	if len(grants) == 0 {
+		return EffectivePermission{}, false
+	}
+
+	sort.SliceStable(grants, func(i, j int) bool {
+		return permissionRank(grants[i].Access) > permissionRank(grants[j].Access)
+	})
+	return EffectivePermission{Login: login, Repo: repo, Access: grants[0].Access, Grants: grants}, true
+}
+
+// teamGraph holds the parent teams and the members of every team of an
+// access configuration.
+type teamGraph struct {
+	// slugs maps the lower cased slug and name of every team to its lower
+	// cased slug.
+	slugs   map[string]string
+	parents map[string][]string
+	// memberOf holds the teams of every lower cased login, in the order of
+	// the configuration.
+	memberOf map[string][]string
+}
+
+func newTeamGraph(config *AccessConfig) *teamGraph {
+	graph := &teamGraph{
+		slugs:    make(map[string]string),
+		parents:  make(map[string][]string),
+		memberOf: make(map[string][]string),
+	}
+	// Slugs take precedence over names, and earlier teams over later ones,
+	// like in findTeam.
+	for i := len(config.Teams) - 1; i >= 0; i-- {
+		graph.slugs[strings.ToLower(config.Teams[i].Name)] = strings.ToLower(config.Teams[i].Slug)
+	}
+	for i := len(config.Teams) - 1; i >= 0; i-- {
+		graph.slugs[strings.ToLower(config.Teams[i].Slug)] = strings.ToLower(config.Teams[i].Slug)
+	}
+
+	for _, team := range config.Teams {
+		for _, child := range team.ChildTeams {
+			if key, ok := graph.slugs[strings.ToLower(child)]; ok {
+				graph.parents[key] = append(graph.parents[key], team.Slug)
+			}
+		}
+		for _, member := range team.Members {
+			key := strings.ToLower(member)
+			graph.memberOf[key] = append(graph.memberOf[key], team.Slug)
+		}
+	}
+	return graph
+}
+
+// key returns the lower cased slug of the team with the given slug or name,
+// or the lower cased value when there is no such team.
+func (g *teamGraph) key(team string) string {
+	if key, ok := g.slugs[strings.ToLower(team)]; ok {
+		return key
+	}
+	return strings.ToLower(team)
+}
+
+// chains returns the teams login gets permissions from: first the teams it
+// is a member of, then their parent teams, each as the shortest chain of team
+// slugs from a team of the user up to the team itself.
+func (g *teamGraph) chains(login string) [][]string {
+	var chains [][]string
+	seen := make(map[string]bool)
+	for _, team := range g.memberOf[strings.ToLower(login)] {
+		if !seen[strings.ToLower(team)] {
+			seen[strings.ToLower(team)] = true
+			chains = append(chains, []string{team})
+		}
+	}
+	// Breadth first, so that every team is reached through its shortest chain.
+	for i := 0; i < len(chains); i++ {
+		chain := chains[i]
+		for _, parent := range g.parents[strings.ToLower(chain[len(chain)-1])] {
+			if seen[strings.ToLower(parent)] {
+				continue
+			}
+			seen[strings.ToLower(parent)] = true
+			chains = append(chains, append(append([]string(nil), chain...), parent))
+		}
+	}
+	return chains
+}
+
+// teamChains returns the team chains of login, see teamGraph.chains.
+func teamChains(config *AccessConfig, login string) [][]string {
+	return newTeamGraph(config).chains(login)
+}
+
+// getDefaultRepositoryPermission returns the base permission of the members
+// of an organization on its repositories, upper cased like the repository
+// permissions. It is empty when the token cannot read it, which needs an
+// organization owner.
+func getDefaultRepositoryPermission(ctx context.Context, client *http.Client, organization string) (string, error) {
+	var org struct {
+		DefaultRepositoryPermission string `json:"default_repository_permission"`
+	}
+	if _, err := restRequest(ctx, client, http.MethodGet, "orgs/"+organization, nil, &org); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(org.DefaultRepositoryPermission), nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveEffectivePermissions(t *testing.T) {
+	// The teams come from the fake GraphQL API, which lists the members of
+	// child teams in their parent teams unless asked for immediate members.
+	config, _, err := exportWithFake(t, newFakeGitHub(t, 2, loadFixture(t, "acme.yaml")), "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+
+	effective := make(map[string]EffectivePermission)
+	for _, permission := range resolveEffectivePermissions(config) {
+		effective[permission.Login+"/"+permission.Repo] = permission
+	}
+
+	tests := []struct {
+		key    string
+		access string
+		grants []PermissionGrant
+	}{
+		{"bob/api", "MAINTAIN", []PermissionGrant{
+			{Access: "MAINTAIN", Kind: grantTeam, Teams: []string{"backend"}},
+			{Access: "WRITE", Kind: grantDirect},
+			{Access: "WRITE", Kind: grantTeam, Teams: []string{"backend", "engineering"}},
+			{Access: "READ", Kind: grantBase},
+		}},
+		{"bob/tools", "READ", []PermissionGrant{{Access: "READ", Kind: grantBase}}},
+		{"alice/docs", "ADMIN", []PermissionGrant{
+			{Access: "ADMIN", Kind: grantOwner},
+			{Access: "READ", Kind: grantBase},
+		}},
+		{"erin/infra", "ADMIN", []PermissionGrant{
+			{Access: "ADMIN", Kind: grantDirect},
+			{Access: "ADMIN", Kind: grantTeam, Teams: []string{"platform"}},
+			{Access: "READ", Kind: grantTeam, Teams: []string{"platform", "engineering"}},
+			{Access: "READ", Kind: grantBase},
+		}},
+		{"outsider/api", "READ", []PermissionGrant{{Access: "READ", Kind: grantDirect}}},
+	}
+	for _, test := range tests {
+		got, ok := effective[test.key]
+		if !ok {
+			t.Errorf("%s: no effective permission", test.key)
+			continue
+		}
+		if got.Access != test.access || !reflect.DeepEqual(got.Grants, test.grants) {
+			t.Errorf("%s = %s %+v, want %s %+v", test.key, got.Access, got.Grants, test.access, test.grants)
+		}
+	}
+
+	// Outside collaborators do not get the base permission.
+	if got, ok := effective["outsider/web"]; ok {
+		t.Errorf("outsider/web = %+v", got)
+	}
+	if got, ok := effective["mallory/api"]; ok {
+		t.Errorf("mallory/api = %+v", got)
+	}
+}
+
+func TestResolveEffectivePermissionsWithoutBasePermission(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	config.Organization.DefaultRepositoryPermission = "NONE"
+
+	for _, permission := range resolveEffectivePermissions(config) {
+		if permission.Login == "frank" && permission.Repo == "tools" {
+			t.Errorf("frank/tools = %+v, want no access", permission)
+		}
+	}
+}
+
+func TestResolveScopedPermissions(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	all := resolveEffectivePermissions(config)
+
+	filter := func(keep func(EffectivePermission) bool) []EffectivePermission {
+		var permissions []EffectivePermission
+		for _, permission := range all {
+			if keep(permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+		return permissions
+	}
+	for _, login := range []string{"alice", "BOB", "erin", "outsider", "nobody"} {
+		want := filter(func(p EffectivePermission) bool { return strings.EqualFold(p.Login, login) })
+		if got := resolveUserPermissions(config, login); !reflect.DeepEqual(got, want) {
+			t.Errorf("resolveUserPermissions(%s) = %+v, want %+v", login, got, want)
+		}
+	}
+	for _, repo := range []string{"api", "INFRA", "tools", "missing"} {
+		want := filter(func(p EffectivePermission) bool { return strings.EqualFold(p.Repo, repo) })
+		if got := resolveRepoPermissions(config, repo); !reflect.DeepEqual(got, want) {
+			t.Errorf("resolveRepoPermissions(%s) = %+v, want %+v", repo, got, want)
+		}
+	}
+}
+
+func TestPermissionGrantDescribe(t *testing.T) {
+	tests := map[string]PermissionGrant{
+		"ADMIN as organization owner":              {Access: "ADMIN", Kind: grantOwner},
+		"WRITE granted directly":                   {Access: "WRITE", Kind: grantDirect},
+		"READ through team platform → engineering": {Access: "READ", Kind: grantTeam, Teams: []string{"platform", "engineering"}},
+		"READ as organization base permission":     {Access: "READ", Kind: grantBase},
+	}
+	for want, grant := range tests {
+		if got := grant.Describe(); got != want {
+			t.Errorf("Describe() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestExportDefaultRepositoryPermission(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.forbidden = []string{"orgs/acme"}
+
+	got, _, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	if got.Organization.DefaultRepositoryPermission != "" {
+		t.Errorf("base permission = %q, want it skipped", got.Organization.DefaultRepositoryPermission)
+	}
+
+	f.forbidden = nil
+	permission, err := f.provider().DefaultRepositoryPermission(context.Background(), "acme")
+	if err != nil || permission != "READ" {
+		t.Errorf("DefaultRepositoryPermission = %q, %v", permission, err)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// resolveEndpoint derives the GraphQL and REST API URLs of a GitHub host:
+//
+//   - github.com: https://api.github.com/graphql and https://api.github.com
+//   - <subdomain>.ghe.com: https://api.<subdomain>.ghe.com/graphql and
+//     https://api.<subdomain>.ghe.com
+//   - GitHub Enterprise Server: <scheme>://<host>/api/graphql and
+//     <scheme>://<host>/api/v3
+//
+// endpoint may omit the scheme, in which case https is used.
+func resolveEndpoint(endpoint string) (string, string, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		endpoint = "https://github.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return "", "", fmt.Errorf("invalid endpoint %q: the scheme must be http or https", endpoint)
+	}
+	if parsed.Host == "" {
+		return "", "", fmt.Errorf("invalid endpoint %q: missing host", endpoint)
+	}
+
+	host := strings.ToLower(parsed.Host)
+	switch {
+	case host == "github.com" || host == "api.github.com":
+		return "https://api.github.com/graphql", "https://api.github.com", nil
+	case strings.HasSuffix(host, ".ghe.com"):
+		apiHost := "api." + strings.TrimPrefix(host, "api.")
+		return "https://" + apiHost + "/graphql", "https://" + apiHost, nil
+	default:
+		base := parsed.Scheme + "://" + parsed.Host
+		return base + "/api/graphql", base + "/api/v3", nil
+	}
+}
+
+// baseTransport is the transport under authentication and retries. It is nil,
+// meaning http.DefaultTransport, unless a CA bundle or a proxy is configured.
+var baseTransport http.RoundTripper
+
+// newBaseTransport returns a transport trusting the certificates of caBundle
+// besides the system ones, and sending requests through proxy. Without a
+// proxy, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables are honored.
+func newBaseTransport(caBundle string, proxy string) (http.RoundTripper, error) {
+	if caBundle == "" && proxy == "" {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading the CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the CA bundle %s", caBundle)
+		}
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return transport, nil
+}
+
+var (
+	verifyEndpointOnce sync.Once
+	verifyEndpointErr  error
+)
+
+// verifyEndpoint runs checkEndpoint once per process.
+func verifyEndpoint(ctx context.Context, client *http.Client) error {
+	verifyEndpointOnce.Do(func() {
+		verifyEndpointErr = checkEndpoint(ctx, client)
+	})
+	return verifyEndpointErr
+}
+
+// checkEndpoint checks that URLREST is a GitHub API by calling its meta
+// endpoint, so a wrong endpoint fails with a clear error instead of on the
+// first query.
+func checkEndpoint(ctx context.Context, client *http.Client) error {
+	var meta struct {
+		InstalledVersion string `json:"installed_version"`
+	}
+	if err := restGet(ctx, client, "meta", &meta); err != nil {
+		return fmt.Errorf("%s does not answer like the GitHub API (check --endpoint): %w", URLREST, err)
+	}
+	if meta.InstalledVersion != "" {
+		log.Printf("GitHub Enterprise Server %s", meta.InstalledVersion)
+	}
+	return nil
+}
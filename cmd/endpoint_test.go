@@ -0,0 +1,132 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint    string
+		wantGraphQL string
+		wantREST    string
+	}{
+		{"", "https://api.github.com/graphql", "https://api.github.com"},
+		{"https://github.com", "https://api.github.com/graphql", "https://api.github.com"},
+		{"github.com", "https://api.github.com/graphql", "https://api.github.com"},
+		{"https://acme.ghe.com", "https://api.acme.ghe.com/graphql", "https://api.acme.ghe.com"},
+		{"https://api.acme.ghe.com/", "https://api.acme.ghe.com/graphql", "https://api.acme.ghe.com"},
+		{"https://github.acme.example", "https://github.acme.example/api/graphql", "https://github.acme.example/api/v3"},
+		{"github.acme.example/", "https://github.acme.example/api/graphql", "https://github.acme.example/api/v3"},
+		{"http://ghes.internal:8080", "http://ghes.internal:8080/api/graphql", "http://ghes.internal:8080/api/v3"},
+	}
+
+	for _, tt := range tests {
+		graphQL, rest, err := resolveEndpoint(tt.endpoint)
+		if err != nil {
+			t.Errorf("resolveEndpoint(%q): %v", tt.endpoint, err)
+			continue
+		}
+		if graphQL != tt.wantGraphQL || rest != tt.wantREST {
+			t.Errorf("resolveEndpoint(%q) = %q, %q; want %q, %q", tt.endpoint, graphQL, rest, tt.wantGraphQL, tt.wantREST)
+		}
+	}
+
+	for _, endpoint := range []string{"ftp://github.acme.example", "https://"} {
+		if _, _, err := resolveEndpoint(endpoint); err == nil {
+			t.Errorf("resolveEndpoint(%q) accepted an invalid endpoint", endpoint)
+		}
+	}
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	f := newFakeGitHub(t, 2)
+	f.installedVersion = "3.10.0"
+	if err := checkEndpoint(context.Background(), f.Client()); err != nil {
+		t.Errorf("checkEndpoint against GitHub: %v", err)
+	}
+
+	notGitHub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>Welcome</html>"))
+	}))
+	defer notGitHub.Close()
+	URLREST = notGitHub.URL
+	if err := checkEndpoint(context.Background(), notGitHub.Client()); err == nil {
+		t.Error("checkEndpoint accepted a server that is not GitHub")
+	}
+}
+
+func TestBaseTransportTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&http.Client{}).Get(server.URL); err == nil {
+		t.Fatal("the test server is trusted without the CA bundle")
+	}
+	transport, err := newBaseTransport(bundle, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with the CA bundle: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestBaseTransportUsesProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	transport, err := newBaseTransport("", proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get("http://ghes.internal/api/v3/meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://ghes.internal/api/v3/meta" {
+		t.Errorf("the proxy received %q", proxied)
+	}
+
+	if _, err := newBaseTransport("", "not a url"); err == nil {
+		t.Error("an invalid proxy was accepted")
+	}
+}
@@ -30,20 +30,56 @@ type OrganizationInfo struct {
 	Login       string `yaml:"login,omitempty"`
 	Description string `yaml:"description,omitempty"`
 	URL         string `yaml:"url,omitempty"`
+	// DefaultRepositoryPermission is the base permission of the members on
+	// every repository: READ, WRITE, ADMIN or NONE.
+	DefaultRepositoryPermission string `yaml:"defaultRepositoryPermission,omitempty"`
 }
 
 // RepositoryInfo represents basic information about a repository.
 type RepositoryInfo struct {
 	Name string `yaml:"name,omitempty"`
 	URL  string `yaml:"url,omitempty"`
+	// UpdatedAt is only kept in the export cache.
+	UpdatedAt string `yaml:"-" json:"-"`
 }
 
 // TeamInfo represents basic information about a team.
 type TeamInfo struct {
-	Name        string   `yaml:"name,omitempty"`
+	Name string `yaml:"name,omitempty"`
+	Slug string `yaml:"slug,omitempty"`
+	// DatabaseID is the numeric ID of the team in the REST API.
+	DatabaseID int64 `yaml:"databaseId,omitempty"`
+	// Privacy is VISIBLE or SECRET.
+	Privacy     string   `yaml:"privacy,omitempty"`
 	Description string   `yaml:"description,omitempty"`
 	Members     []string `yaml:"members,omitempty"`
+	// Maintainers are the members with the maintainer role in the team.
+	Maintainers []string `yaml:"maintainers,omitempty"`
 	ChildTeams  []string `yaml:"childTeam,omitempty"`
+	// IdPManaged is set when the membership of the team is synchronized from
+	// an identity provider group, so it must not be changed from GitHub.
+	IdPManaged bool         `yaml:"idpManaged,omitempty"`
+	IdPGroups  IdPGroupList `yaml:"idpGroups,omitempty"`
+	// UpdatedAt is only kept in the export cache.
+	UpdatedAt string `yaml:"-" json:"-"`
+}
+
+// IdPGroupInfo represents an identity provider group mapped to a team through team synchronization.
+type IdPGroupInfo struct {
+	ID          string `yaml:"id,omitempty"`
+	Name        string `yaml:"name,omitempty"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// IdPGroupList lists the identity provider groups mapped to a team. Like a
+// RoleList, a nil list is left out of the file and means the mapping is
+// unknown, so it is left as it is, while an empty list, written as [], means
+// the team is not mapped.
+type IdPGroupList []IdPGroupInfo
+
+// IsZero reports whether the mapping is unknown, leaving it out of the file.
+func (l IdPGroupList) IsZero() bool {
+	return l == nil
 }
 
 // MemberInfo represents basic information about a member.
@@ -69,6 +105,56 @@ type PermissionsInfo struct {
 	Users []UserPermission `yaml:"users,omitempty"`
 }
 
+// WebhookInfo represents an organization or repository webhook. Only the host
+// of the delivery URL is exported, never the full URL or the secret.
+type WebhookInfo struct {
+	Repo        string   `yaml:"repo,omitempty"`
+	Host        string   `yaml:"host,omitempty"`
+	Events      []string `yaml:"events,omitempty"`
+	Active      bool     `yaml:"active"`
+	ContentType string   `yaml:"contentType,omitempty"`
+	SSLVerify   bool     `yaml:"sslVerify"`
+}
+
+// ModeratorsInfo lists the users and teams holding the organization moderator role.
+type ModeratorsInfo struct {
+	Users RoleList `yaml:"users,omitempty"`
+	Teams RoleList `yaml:"teams,omitempty"`
+}
+
+// RoleList lists the holders of an organization role. A nil list is left out
+// of the file and means the holders are unknown, so they are left as they
+// are, while an empty list, written as [], means nobody holds the role.
+type RoleList []string
+
+// IsZero reports whether the list is unknown, leaving it out of the file.
+func (l RoleList) IsZero() bool {
+	return l == nil
+}
+
+// EnvironmentInfo represents the required reviewers of a deployment environment.
+type EnvironmentInfo struct {
+	Repo  string   `yaml:"repo,omitempty"`
+	Name  string   `yaml:"name,omitempty"`
+	Users []string `yaml:"users,omitempty"`
+	Teams []string `yaml:"teams,omitempty"`
+}
+
+// BranchProtectionInfo represents the users and teams allowed to bypass a
+// branch protection rule, either its required pull requests or its force
+// push restriction.
+type BranchProtectionInfo struct {
+	Repo        string   `yaml:"repo,omitempty"`
+	Pattern     string   `yaml:"pattern,omitempty"`
+	BypassUsers []string `yaml:"bypassUsers,omitempty"`
+	BypassTeams []string `yaml:"bypassTeams,omitempty"`
+}
+
+type WebhooksInfo struct {
+	Organization []WebhookInfo `yaml:"organization,omitempty"`
+	Repositories []WebhookInfo `yaml:"repositories,omitempty"`
+}
+
 // AccessConfig represents the overall structure of access-config.yaml.
 type AccessConfig struct {
 	Organization OrganizationInfo `yaml:"organization,omitempty"`
@@ -76,9 +162,40 @@ type AccessConfig struct {
 	Teams        []TeamInfo       `yaml:"teams,omitempty"`
 	Members      []MemberInfo     `yaml:"members,omitempty"`
 	Permissions  PermissionsInfo  `yaml:"permissions,omitempty"`
+	Webhooks     WebhooksInfo     `yaml:"webhooks,omitempty"`
+	// Environments lists the deployment environments with required reviewers.
+	Environments      []EnvironmentInfo      `yaml:"environments,omitempty"`
+	BranchProtections []BranchProtectionInfo `yaml:"branchProtections,omitempty"`
+	// SecurityManagers lists the slugs of the teams with the security manager role.
+	SecurityManagers RoleList       `yaml:"securityManagers,omitempty"`
+	Moderators       ModeratorsInfo `yaml:"moderators,omitempty"`
+}
+
+// IdentityMap maps the GitHub logins of an organization to their corporate
+// identities. It is saved next to the access configuration.
+type IdentityMap struct {
+	Organization string         `yaml:"organization,omitempty"`
+	Identities   []IdentityInfo `yaml:"identities,omitempty"`
+}
+
+// IdentityInfo represents the SAML and SCIM identity linked to a GitHub login.
+type IdentityInfo struct {
+	Login        string   `yaml:"login,omitempty"`
+	NameID       string   `yaml:"nameId,omitempty"`
+	SCIMUsername string   `yaml:"scimUsername,omitempty"`
+	Emails       []string `yaml:"emails,omitempty"`
+}
+
+// RateLimitInfo is requested along with every query so that the transport can
+// account for the cost of the run and wait when the budget is exhausted.
+type RateLimitInfo struct {
+	Cost      githubv4.Int
+	Remaining githubv4.Int
+	ResetAt   githubv4.DateTime
 }
 
 type OrganizationQuery struct {
+	RateLimit    RateLimitInfo
 	Organization struct {
 		ID          githubv4.String
 		Name        githubv4.String
@@ -89,12 +206,14 @@ type OrganizationQuery struct {
 }
 
 type RepoQuery struct {
+	RateLimit    RateLimitInfo
 	Organization struct {
 		Repositories struct {
 			Edges []struct {
 				Node struct {
-					Name githubv4.String
-					URL  githubv4.String
+					Name      githubv4.String
+					URL       githubv4.String
+					UpdatedAt githubv4.String
 				}
 			}
 			PageInfo struct {
@@ -105,24 +224,33 @@ type RepoQuery struct {
 	} `graphql:"organization(login: $org)"`
 }
 
+// TeamQuery fetches the teams with their immediate members only: the members
+// of child teams inherit the permissions of the parent team without being
+// its members, and are listed in their own team.
 type TeamQuery struct {
+	RateLimit    RateLimitInfo
 	Organization struct {
 		Teams struct {
 			Edges []struct {
 				Node struct {
 					Name        githubv4.String
+					Slug        githubv4.String
+					DatabaseID  githubv4.Int
 					Description githubv4.String
+					Privacy     githubv4.String
+					UpdatedAt   githubv4.String
 					Members     struct {
 						Edges []struct {
 							Node struct {
 								Login githubv4.String
 							}
+							Role githubv4.String
 						}
 						PageInfo struct {
 							EndCursor   githubv4.String
 							HasNextPage bool
 						}
-					} `graphql:"members(first: 100, after: $memberCursor, orderBy:{field:LOGIN, direction:ASC})"`
+					} `graphql:"members(first: 100, membership: IMMEDIATE, orderBy:{field:LOGIN, direction:ASC})"`
 					ChildTeams struct {
 						Edges []struct {
 							Node struct {
@@ -133,7 +261,7 @@ type TeamQuery struct {
 							EndCursor   githubv4.String
 							HasNextPage bool
 						}
-					} `graphql:"childTeams(first: 100, after: $childTeamCursor, orderBy:{field:NAME, direction:ASC})"`
+					} `graphql:"childTeams(first: 100, orderBy:{field:NAME, direction:ASC})"`
 				}
 			}
 			PageInfo struct {
@@ -144,7 +272,49 @@ type TeamQuery struct {
 	} `graphql:"organization(login: $org)"`
 }
 
+// TeamMemberQuery fetches the members of a team beyond the first page of TeamQuery.
+type TeamMemberQuery struct {
+	RateLimit    RateLimitInfo
+	Organization struct {
+		Team struct {
+			Members struct {
+				Edges []struct {
+					Node struct {
+						Login githubv4.String
+					}
+					Role githubv4.String
+				}
+				PageInfo struct {
+					EndCursor   githubv4.String
+					HasNextPage bool
+				}
+			} `graphql:"members(first: 100, after: $memberCursor, membership: IMMEDIATE, orderBy:{field:LOGIN, direction:ASC})"`
+		} `graphql:"team(slug: $slug)"`
+	} `graphql:"organization(login: $org)"`
+}
+
+// ChildTeamQuery fetches the child teams of a team beyond the first page of TeamQuery.
+type ChildTeamQuery struct {
+	RateLimit    RateLimitInfo
+	Organization struct {
+		Team struct {
+			ChildTeams struct {
+				Edges []struct {
+					Node struct {
+						Name githubv4.String
+					}
+				}
+				PageInfo struct {
+					EndCursor   githubv4.String
+					HasNextPage bool
+				}
+			} `graphql:"childTeams(first: 100, after: $childTeamCursor, orderBy:{field:NAME, direction:ASC})"`
+		} `graphql:"team(slug: $slug)"`
+	} `graphql:"organization(login: $org)"`
+}
+
 type MemberQuery struct {
+	RateLimit    RateLimitInfo
 	Organization struct {
 		MembersWithRole struct {
 			Edges []struct {
@@ -162,6 +332,7 @@ type MemberQuery struct {
 }
 
 type TeamPermissionQuery struct {
+	RateLimit    RateLimitInfo
 	Organization struct {
 		Team struct {
 			Repositories struct {
@@ -180,7 +351,11 @@ type TeamPermissionQuery struct {
 	} `graphql:"organization(login: $org)"`
 }
 
+// RepoPermissionQuery fetches only the direct collaborators of each
+// repository: access through teams is exported in Permissions.Teams, and the
+// owner role and the base permission are resolved by effective.
 type RepoPermissionQuery struct {
+	RateLimit    RateLimitInfo
 	Organization struct {
 		Repositories struct {
 			Edges []struct {
@@ -197,7 +372,7 @@ type RepoPermissionQuery struct {
 							EndCursor   githubv4.String
 							HasNextPage bool
 						}
-					} `graphql:"collaborators(first: 100, after: $collabCursor)"`
+					} `graphql:"collaborators(first: 100, affiliation: DIRECT)"`
 				}
 			}
 			PageInfo struct {
@@ -207,3 +382,56 @@ type RepoPermissionQuery struct {
 		} `graphql:"repositories(first: 100, after: $repoCursor, orderBy: {field:CREATED_AT,direction:ASC})"`
 	} `graphql:"organization(login: $org)"`
 }
+
+// RepoCollaboratorQuery fetches the collaborators of a repository beyond the
+// first page of RepoPermissionQuery.
+type RepoCollaboratorQuery struct {
+	RateLimit  RateLimitInfo
+	Repository struct {
+		Collaborators struct {
+			Edges []struct {
+				Node struct {
+					Login githubv4.String
+				}
+				Permission githubv4.String
+			}
+			PageInfo struct {
+				EndCursor   githubv4.String
+				HasNextPage bool
+			}
+		} `graphql:"collaborators(first: 100, after: $collabCursor, affiliation: DIRECT)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+}
+
+type ExternalIdentityQuery struct {
+	RateLimit    RateLimitInfo
+	Organization struct {
+		SamlIdentityProvider struct {
+			ExternalIdentities struct {
+				Edges []struct {
+					Node struct {
+						SamlIdentity struct {
+							NameId githubv4.String
+							Emails []struct {
+								Value githubv4.String
+							}
+						}
+						ScimIdentity struct {
+							Username githubv4.String
+							Emails   []struct {
+								Value githubv4.String
+							}
+						}
+						User struct {
+							Login githubv4.String
+						}
+					}
+				}
+				PageInfo struct {
+					EndCursor   githubv4.String
+					HasNextPage bool
+				}
+			} `graphql:"externalIdentities(first: 100, after: $afterCursor)"`
+		}
+	} `graphql:"organization(login: $org)"`
+}
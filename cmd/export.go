@@ -23,94 +23,281 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 
 	"github.com/schollz/progressbar/v3"
 	"github.com/shurcooL/githubv4"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/oauth2"
-	"gopkg.in/yaml.v3"
 )
 
 // exportCmd represents the export command
 var exportCmd = &cobra.Command{
 	Use:   "export",
 	Short: "Export the current access configuration from GitHub",
+	Long: `Export the current access configuration from GitHub.
+
+The result of every export is cached per organization, and REST requests are
+sent as conditional requests, which GitHub answers from the cache when nothing
+changed.
+
+With --incremental, the export only queries the repositories and teams whose
+updatedAt changed since the cached export and reuses the cached permissions of
+the rest. GitHub does not change the updatedAt of a repository or a team when
+a collaborator or a team grant changes, so an incremental export can miss
+permission changes: use it for quick local checks, not for the file of
+record.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		incremental, _ := cmd.Flags().GetBool("incremental")
 
-		exportConfig(organizationList)
+		exportConfig(organizationList, incremental)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(exportCmd)
 
+	exportCmd.Flags().IntP("concurrency", "c", defaultConcurrency, "Maximum number of concurrent requests to GitHub.")
+	viper.BindPFlag("concurrency", exportCmd.Flags().Lookup("concurrency"))
+	viper.SetDefault("concurrency", defaultConcurrency)
+
+	exportCmd.Flags().Bool("incremental", false, "Reuse the cached permissions of the repositories and teams whose updatedAt did not change. It can miss permission changes.")
+	exportCmd.Flags().Bool("full", false, "Fetch every entity again.")
+	exportCmd.Flags().MarkDeprecated("full", "exports are full unless --incremental is set")
+	exportCmd.Flags().String("cache-dir", "", "Directory of the export cache. By default the user cache directory.")
+	viper.BindPFlag("cache-dir", exportCmd.Flags().Lookup("cache-dir"))
 }
 
-func exportConfig(organizations []string) {
+func exportConfig(organizations []string, incremental bool) {
 
 	var (
-		accessConfig AccessConfig
+		accessConfigs = make([]*AccessConfig, len(organizations))
+		identityMaps  = make([]*IdentityMap, len(organizations))
 	)
 
 	orgProgress := progressbar.Default(int64(len(organizations)), "Starting..")
-	src := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: viper.GetString("token")},
-	)
-	httpClient := oauth2.NewClient(context.Background(), src)
+	ctx := context.Background()
 
-	client := githubv4.NewEnterpriseClient(URLGRAPHQL, httpClient)
+	pool := newWorkerPool(viper.GetInt("concurrency"))
+	loadETagCache()
 
-	ctx := context.Background()
+	orgs := newTaskGroup(nil)
+	for i, allowedOrg := range organizations {
+		i, allowedOrg := i, allowedOrg
+		orgs.Go(func() error {
+			var cache *exportCache
+			if incremental {
+				cache = loadExportCache(allowedOrg)
+			}
 
-	for _, allowedOrg := range organizations {
-		orgInfo, err := getOrganizationInfo(ctx, client, allowedOrg)
-		if err != nil {
-			log.Printf("Failed to get organization info for %s: %v\n", allowedOrg, err)
-			continue // Continúa con la siguiente organización si hay un error
+			// Each organization gets its own client, as GitHub App
+			// installation tokens are only valid for one organization.
+			provider, err := newGitHubProvider(ctx, allowedOrg)
+			if err != nil {
+				log.Printf("Failed to export organization %s: %v\n", allowedOrg, err)
+				return nil
+			}
+			accessConfig, identityMap, err := exportOrganization(ctx, pool, provider, allowedOrg, cache)
+			if err != nil {
+				log.Printf("Failed to export organization %s: %v\n", allowedOrg, err)
+				return nil // Continúa con la siguiente organización si hay un error
+			}
+			if err := saveExportCache(allowedOrg, accessConfig); err != nil {
+				log.Printf("Failed to save the export cache of %s: %v\n", allowedOrg, err)
+			}
+			accessConfigs[i] = accessConfig
+			identityMaps[i] = identityMap
+			orgProgress.Add(1)
+			return nil
+		})
+	}
+	orgs.Wait()
+
+	if err := saveETagCache(); err != nil {
+		log.Printf("Failed to save the REST cache: %v\n", err)
+	}
+
+	// Files are written in the order of the organization list, so the output
+	// does not depend on which organization finished first.
+	for i, allowedOrg := range organizations {
+		if accessConfigs[i] == nil {
+			continue
 		}
 
-		repoInfo, err := getRepos(ctx, client, allowedOrg)
-		if err != nil {
-			log.Printf("Failed to get organization info for %s: %v\n", allowedOrg, err)
-			continue // Continúa con la siguiente organización si hay un error
+		suffix := ""
+		if len(organizations) > 1 {
+			suffix = "-" + allowedOrg
 		}
 
-		teamInfo, err := getTeams(ctx, client, allowedOrg)
+		err := SaveConfig("access-config"+suffix, accessConfigs[i])
 		if err != nil {
-			log.Printf("Failed to get organization info for %s: %v\n", allowedOrg, err)
-			continue // Continúa con la siguiente organización si hay un error
+			log.Fatalf("Failed to save config: %v", err)
 		}
-		memberInfo, err := getMembers(ctx, client, allowedOrg)
-		if err != nil {
-			log.Printf("Failed to get organization info for %s: %v\n", allowedOrg, err)
-			continue // Continúa con la siguiente organización si hay un error
+		fmt.Println("Access configuration exported successfully for", allowedOrg)
+
+		if len(identityMaps[i].Identities) > 0 {
+			err = SaveIdentityMap("identity-map"+suffix, identityMaps[i])
+			if err != nil {
+				log.Fatalf("Failed to save identity map: %v", err)
+			}
+			fmt.Println("Identity map exported successfully for", allowedOrg)
 		}
+	}
+}
+
+// exportOrganization fetches the access configuration of one organization.
+// Independent entities are fetched concurrently, bounded by pool, and every
+// list keeps the order returned by GitHub regardless of completion order.
+// When cache is not nil, the permissions of the repositories and teams that
+// did not change since the cached export are reused.
+func exportOrganization(ctx context.Context, pool *workerPool, provider Provider, organization string, cache *exportCache) (*AccessConfig, *IdentityMap, error) {
+	var (
+		accessConfig   AccessConfig
+		identityMap    = IdentityMap{Organization: organization}
+		basePermission string
+	)
 
+	g := newTaskGroup(pool)
+	g.Go(func() error {
+		orgInfo, err := provider.OrganizationInfo(ctx, organization)
+		if err != nil {
+			return fmt.Errorf("organization info: %w", err)
+		}
 		accessConfig.Organization = orgInfo
+		return nil
+	})
+	g.Go(func() error {
+		repoInfo, err := provider.Repos(ctx, organization)
+		if err != nil {
+			return fmt.Errorf("repositories: %w", err)
+		}
 		accessConfig.Repositories = repoInfo
+		return nil
+	})
+	g.Go(func() error {
+		teamInfo, err := provider.Teams(ctx, organization)
+		if err != nil {
+			return fmt.Errorf("teams: %w", err)
+		}
 		accessConfig.Teams = teamInfo
+		return nil
+	})
+	g.Go(func() error {
+		memberInfo, err := provider.Members(ctx, organization)
+		if err != nil {
+			return fmt.Errorf("members: %w", err)
+		}
 		accessConfig.Members = memberInfo
-
-		permissionInfo, err := getPermissions(ctx, client, allowedOrg, teamInfo)
+		return nil
+	})
+	g.Go(func() error {
+		permission, err := provider.DefaultRepositoryPermission(ctx, organization)
 		if err != nil {
-			log.Printf("Failed to get organization info for %s: %v\n", allowedOrg, err)
-			continue
+			if !skipUnavailable(err, "an organization owner token") {
+				return fmt.Errorf("base permission: %w", err)
+			}
+			log.Printf("Skipping the base permission of %s: %v\n", organization, err)
 		}
-		accessConfig.Permissions = permissionInfo
-		orgProgress.Add(1)
+		basePermission = permission
+		return nil
+	})
+	// Roles the token cannot read are left out of the file, so that roles
+	// apply leaves them as they are instead of revoking them.
+	g.Go(func() error {
+		securityManagers, err := provider.SecurityManagers(ctx, organization)
+		if err != nil {
+			if !skipUnavailable(err, "the read:org scope as an organization owner or security manager") {
+				return fmt.Errorf("security managers: %w", err)
+			}
+			log.Printf("The security managers of %s are unknown, leaving them out: %v\n", organization, err)
+		}
+		accessConfig.SecurityManagers = securityManagers
+		return nil
+	})
+	g.Go(func() error {
+		moderators, err := provider.Moderators(ctx, organization)
+		if err != nil {
+			if !skipUnavailable(err, "the read:org scope as an organization owner") {
+				return fmt.Errorf("moderators: %w", err)
+			}
+			log.Printf("The moderators of %s are unknown, leaving them out: %v\n", organization, err)
+		}
+		accessConfig.Moderators = moderators
+		return nil
+	})
+	g.Go(func() error {
+		identities, err := provider.ExternalIdentities(ctx, organization)
+		if err != nil {
+			if !skipUnavailable(err, "the admin:org scope") && !isGraphQLForbidden(err) {
+				return fmt.Errorf("external identities: %w", err)
+			}
+			log.Printf("Skipping the identity map of %s: %v\n", organization, err)
+		}
+		identityMap.Identities = identities
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
 	}
+	accessConfig.Organization.DefaultRepositoryPermission = basePermission
 
-	err := SaveConfig("access-config", &accessConfig)
-	if err != nil {
-		log.Fatalf("Failed to save config: %v", err)
+	if cache != nil {
+		changedRepos, changedTeams := 0, 0
+		for _, repo := range accessConfig.Repositories {
+			if !cache.unchangedRepo(repo) {
+				changedRepos++
+			}
+		}
+		for _, team := range accessConfig.Teams {
+			if !cache.unchangedTeam(team) {
+				changedTeams++
+			}
+		}
+		log.Printf("Incremental export of %s: %d/%d repositories and %d/%d teams changed\n", organization, changedRepos, len(accessConfig.Repositories), changedTeams, len(accessConfig.Teams))
+	}
+
+	// The second stage fans out per team and per repository.
+	stage := newTaskGroup(nil)
+	stage.Go(func() error {
+		err := getTeamSyncMappings(ctx, pool, provider, organization, accessConfig.Teams)
+		if err != nil {
+			return fmt.Errorf("team sync mappings: %w", err)
+		}
+		return nil
+	})
+	stage.Go(func() error {
+		permissionInfo, err := getPermissions(ctx, pool, provider, organization, accessConfig.Teams, accessConfig.Repositories, cache)
+		if err != nil {
+			return fmt.Errorf("permissions: %w", err)
+		}
+		accessConfig.Permissions = permissionInfo
+		return nil
+	})
+	stage.Go(func() error {
+		webhookInfo, err := getWebhooks(ctx, pool, provider, organization, accessConfig.Repositories)
+		if err != nil {
+			return fmt.Errorf("webhooks: %w", err)
+		}
+		accessConfig.Webhooks = webhookInfo
+		return nil
+	})
+	stage.Go(func() error {
+		environments, protections, err := getProtections(ctx, pool, provider, organization, accessConfig.Repositories)
+		if err != nil {
+			return fmt.Errorf("protections: %w", err)
+		}
+		accessConfig.Environments = environments
+		accessConfig.BranchProtections = protections
+		return nil
+	})
+	if err := stage.Wait(); err != nil {
+		return nil, nil, err
 	}
 
-	fmt.Println("Access configuration exported successfully to", aacFilePath)
+	return &accessConfig, &identityMap, nil
 }
 
 func getOrganizationInfo(ctx context.Context, client *githubv4.Client, organization string) (OrganizationInfo, error) {
@@ -156,8 +343,9 @@ func getRepos(ctx context.Context, client *githubv4.Client, organization string)
 
 		for _, edge := range query.Organization.Repositories.Edges {
 			repoInfo := RepositoryInfo{
-				Name: string(edge.Node.Name),
-				URL:  string(edge.Node.URL),
+				Name:      string(edge.Node.Name),
+				URL:       string(edge.Node.URL),
+				UpdatedAt: string(edge.Node.UpdatedAt),
 			}
 			allRepos = append(allRepos, repoInfo)
 		}
@@ -175,18 +363,13 @@ func getRepos(ctx context.Context, client *githubv4.Client, organization string)
 func getTeams(ctx context.Context, client *githubv4.Client, organization string) ([]TeamInfo, error) {
 	var allTeams []TeamInfo
 	var teamCursor *githubv4.String
-	var memberCursor *githubv4.String
-	var childTeamCursor *githubv4.String
 
-TeamLoop:
 	for {
 		var query TeamQuery
 
 		variables := map[string]interface{}{
-			"org":             githubv4.String(organization),
-			"teamCursor":      teamCursor,
-			"childTeamCursor": childTeamCursor,
-			"memberCursor":    memberCursor,
+			"org":        githubv4.String(organization),
+			"teamCursor": teamCursor,
 		}
 
 		err := client.Query(ctx, &query, variables)
@@ -198,73 +381,122 @@ TeamLoop:
 
 			teamInfo := TeamInfo{
 				Name:        string(teams.Node.Name),
+				Slug:        string(teams.Node.Slug),
+				DatabaseID:  int64(teams.Node.DatabaseID),
 				Description: string(teams.Node.Description),
+				Privacy:     string(teams.Node.Privacy),
+				UpdatedAt:   string(teams.Node.UpdatedAt),
 			}
 
-		MemberLoop:
-			for {
-
-				for _, members := range teams.Node.Members.Edges {
-					teamInfo.Members = append(teamInfo.Members, string(members.Node.Login))
+			for _, members := range teams.Node.Members.Edges {
+				teamInfo.Members = append(teamInfo.Members, string(members.Node.Login))
+				if members.Role == "MAINTAINER" {
+					teamInfo.Maintainers = append(teamInfo.Maintainers, string(members.Node.Login))
 				}
-				if !teams.Node.Members.PageInfo.HasNextPage {
-					break MemberLoop
-				}
-				memberCursor = &teams.Node.Members.PageInfo.EndCursor
-
-				variables := map[string]interface{}{
-					"org":             githubv4.String(organization),
-					"teamCursor":      teamCursor,
-					"childTeamCursor": childTeamCursor,
-					"memberCursor":    memberCursor,
-				}
-
-				err := client.Query(ctx, &query, variables)
+			}
+			if teams.Node.Members.PageInfo.HasNextPage {
+				members, maintainers, err := getTeamMembers(ctx, client, organization, teamInfo.Slug, teams.Node.Members.PageInfo.EndCursor)
 				if err != nil {
-					return nil, fmt.Errorf("error ejecutando la consulta: %v", err)
+					return nil, err
 				}
+				teamInfo.Members = append(teamInfo.Members, members...)
+				teamInfo.Maintainers = append(teamInfo.Maintainers, maintainers...)
 			}
-		ChildTeamLoop:
-			for {
-
-				for _, childTeam := range teams.Node.ChildTeams.Edges {
-					teamInfo.ChildTeams = append(teamInfo.Members, string(childTeam.Node.Name))
-				}
-
-				if !teams.Node.ChildTeams.PageInfo.HasNextPage {
-					break ChildTeamLoop
-				}
-				memberCursor = &teams.Node.Members.PageInfo.EndCursor
-
-				variables := map[string]interface{}{
-					"org":             githubv4.String(organization),
-					"teamCursor":      teamCursor,
-					"childTeamCursor": childTeamCursor,
-					"memberCursor":    memberCursor,
-				}
 
-				err := client.Query(ctx, &query, variables)
+			for _, childTeam := range teams.Node.ChildTeams.Edges {
+				teamInfo.ChildTeams = append(teamInfo.ChildTeams, string(childTeam.Node.Name))
+			}
+			if teams.Node.ChildTeams.PageInfo.HasNextPage {
+				childTeams, err := getChildTeams(ctx, client, organization, teamInfo.Slug, teams.Node.ChildTeams.PageInfo.EndCursor)
 				if err != nil {
-					return nil, fmt.Errorf("error ejecutando la consulta: %v", err)
+					return nil, err
 				}
+				teamInfo.ChildTeams = append(teamInfo.ChildTeams, childTeams...)
 			}
 
 			allTeams = append(allTeams, teamInfo)
-
 		}
 
 		if !query.Organization.Teams.PageInfo.HasNextPage {
-			break TeamLoop
+			break
 		}
 
 		teamCursor = &query.Organization.Teams.PageInfo.EndCursor
-		memberCursor = nil
-		childTeamCursor = nil
 	}
 
 	return allTeams, nil
 }
 
+// getTeamMembers fetches the members of a team after memberCursor, and the
+// ones among them with the maintainer role.
+func getTeamMembers(ctx context.Context, client *githubv4.Client, organization string, slug string, memberCursor githubv4.String) ([]string, []string, error) {
+	var members, maintainers []string
+	cursor := &memberCursor
+
+	for {
+		var query TeamMemberQuery
+
+		variables := map[string]interface{}{
+			"org":          githubv4.String(organization),
+			"slug":         githubv4.String(slug),
+			"memberCursor": cursor,
+		}
+
+		err := client.Query(ctx, &query, variables)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error ejecutando la consulta: %v", err)
+		}
+
+		for _, member := range query.Organization.Team.Members.Edges {
+			members = append(members, string(member.Node.Login))
+			if member.Role == "MAINTAINER" {
+				maintainers = append(maintainers, string(member.Node.Login))
+			}
+		}
+
+		if !query.Organization.Team.Members.PageInfo.HasNextPage {
+			break
+		}
+
+		cursor = &query.Organization.Team.Members.PageInfo.EndCursor
+	}
+
+	return members, maintainers, nil
+}
+
+// getChildTeams fetches the child teams of a team after childTeamCursor.
+func getChildTeams(ctx context.Context, client *githubv4.Client, organization string, slug string, childTeamCursor githubv4.String) ([]string, error) {
+	var childTeams []string
+	cursor := &childTeamCursor
+
+	for {
+		var query ChildTeamQuery
+
+		variables := map[string]interface{}{
+			"org":             githubv4.String(organization),
+			"slug":            githubv4.String(slug),
+			"childTeamCursor": cursor,
+		}
+
+		err := client.Query(ctx, &query, variables)
+		if err != nil {
+			return nil, fmt.Errorf("error ejecutando la consulta: %v", err)
+		}
+
+		for _, childTeam := range query.Organization.Team.ChildTeams.Edges {
+			childTeams = append(childTeams, string(childTeam.Node.Name))
+		}
+
+		if !query.Organization.Team.ChildTeams.PageInfo.HasNextPage {
+			break
+		}
+
+		cursor = &query.Organization.Team.ChildTeams.PageInfo.EndCursor
+	}
+
+	return childTeams, nil
+}
+
 func getMembers(ctx context.Context, client *githubv4.Client, organization string) ([]MemberInfo, error) {
 	var allMembers []MemberInfo
 	var afterCursor *githubv4.String
@@ -301,144 +533,274 @@ func getMembers(ctx context.Context, client *githubv4.Client, organization strin
 	return allMembers, nil
 }
 
-func getPermissions(ctx context.Context, client *githubv4.Client, organization string, teams []TeamInfo) (PermissionsInfo, error) {
+// getPermissions fetches the repositories of every team and the
+// collaborators of every repository, concurrently on pool. With a cache, the
+// permissions of unchanged teams and repositories are taken from it and only
+// the changed ones are queried.
+func getPermissions(ctx context.Context, pool *workerPool, provider Provider, organization string, teams []TeamInfo, repos []RepositoryInfo, cache *exportCache) (PermissionsInfo, error) {
 	var (
-		teamPermissions []TeamPermission
-		userPermissions []UserPermission
-	)
-	var (
-		repoCursor   *githubv4.String
-		collabCursor *githubv4.String
+		teamPermissions = make([][]TeamPermission, len(teams))
+		userPermissions [][]UserPermission
+		mu              sync.Mutex
 	)
 
-TeamPermissions:
-	for _, slug := range teams {
+	g := newTaskGroup(pool)
+
+	for i := range teams {
+		// Only the slug is read: other fields of the team may be filled concurrently.
+		i, slug := i, teams[i].Slug
+		if cache.unchangedTeam(TeamInfo{Slug: slug, UpdatedAt: teams[i].UpdatedAt}) {
+			for _, permission := range cache.Config.Permissions.Teams {
+				if permission.Slug == slug {
+					teamPermissions[i] = append(teamPermissions[i], permission)
+				}
+			}
+			continue
+		}
+		g.Go(func() error {
+			permissions, err := provider.TeamPermissions(ctx, organization, slug)
+			if err != nil {
+				return fmt.Errorf("team %s: %w", slug, err)
+			}
+			teamPermissions[i] = permissions
+			return nil
+		})
+	}
+
+	if cache != nil {
+		userPermissions = make([][]UserPermission, len(repos))
+		for i, repo := range repos {
+			i, repo := i, repo
+			if cache.unchangedRepo(repo) {
+				for _, permission := range cache.Config.Permissions.Users {
+					if permission.Repo == repo.Name {
+						userPermissions[i] = append(userPermissions[i], permission)
+					}
+				}
+				continue
+			}
+			g.Go(func() error {
+				permissions, err := provider.RepoCollaborators(ctx, organization, repo.Name, nil)
+				if err != nil {
+					return fmt.Errorf("repository %s: %w", repo.Name, err)
+				}
+				userPermissions[i] = permissions
+				return nil
+			})
+		}
+	} else {
+		g.Go(func() error {
+			var repoCursor *string
 
+			for {
+				page, err := provider.CollaboratorsPage(ctx, organization, repoCursor)
+				if err != nil {
+					return err
+				}
+
+				for _, repo := range page.Repos {
+					mu.Lock()
+					i := len(userPermissions)
+					userPermissions = append(userPermissions, repo.Permissions)
+					mu.Unlock()
+
+					if repo.NextCursor != nil {
+						repo := repo
+						g.Go(func() error {
+							more, err := provider.RepoCollaborators(ctx, organization, repo.Repo, repo.NextCursor)
+							if err != nil {
+								return fmt.Errorf("repository %s: %w", repo.Repo, err)
+							}
+							mu.Lock()
+							userPermissions[i] = append(userPermissions[i], more...)
+							mu.Unlock()
+							return nil
+						})
+					}
+				}
+
+				if page.EndCursor == nil {
+					return nil
+				}
+
+				repoCursor = page.EndCursor
+			}
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return PermissionsInfo{}, err
+	}
+
+	var permissions PermissionsInfo
+	for _, p := range teamPermissions {
+		permissions.Teams = append(permissions.Teams, p...)
+	}
+	for _, p := range userPermissions {
+		permissions.Users = append(permissions.Users, p...)
+	}
+	return permissions, nil
+}
+
+// getCollaboratorsPage fetches a page of repositories after repoCursor with
+// the first page of their collaborators.
+func getCollaboratorsPage(ctx context.Context, client *githubv4.Client, organization string, repoCursor *string) (CollaboratorsPage, error) {
+	var query RepoPermissionQuery
+
+	var cursor *githubv4.String
+	if repoCursor != nil {
+		cursor = githubv4.NewString(githubv4.String(*repoCursor))
+	}
+
+	variables := map[string]interface{}{
+		"org":        githubv4.String(organization),
+		"repoCursor": cursor,
+	}
+
+	err := client.Query(ctx, &query, variables)
+	if err != nil {
+		return CollaboratorsPage{}, fmt.Errorf("error ejecutando la consulta: %v", err)
+	}
+
+	var page CollaboratorsPage
+	for _, repo := range query.Organization.Repositories.Edges {
+		repoCollaborators := RepoCollaborators{Repo: string(repo.Node.Name)}
+		for _, member := range repo.Node.Collaborators.Edges {
+			repoCollaborators.Permissions = append(repoCollaborators.Permissions, UserPermission{
+				Repo:   string(repo.Node.Name),
+				Access: string(member.Permission),
+				Login:  string(member.Node.Login),
+			})
+		}
+		if repo.Node.Collaborators.PageInfo.HasNextPage {
+			endCursor := string(repo.Node.Collaborators.PageInfo.EndCursor)
+			repoCollaborators.NextCursor = &endCursor
+		}
+		page.Repos = append(page.Repos, repoCollaborators)
+	}
+
+	if query.Organization.Repositories.PageInfo.HasNextPage {
+		endCursor := string(query.Organization.Repositories.PageInfo.EndCursor)
+		page.EndCursor = &endCursor
+	}
+
+	return page, nil
+}
+
+func getTeamPermissions(ctx context.Context, client *githubv4.Client, organization string, slug string) ([]TeamPermission, error) {
+	var teamPermissions []TeamPermission
+	var repoCursor *githubv4.String
+
+	for {
 		var query TeamPermissionQuery
 
 		variables := map[string]interface{}{
 			"org":        githubv4.String(organization),
 			"repoCursor": repoCursor,
-			"slug":       githubv4.String(slug.Name),
+			"slug":       githubv4.String(slug),
 		}
 
 		err := client.Query(ctx, &query, variables)
 		if err != nil {
-			return PermissionsInfo{}, fmt.Errorf("error ejecutando la consulta: %v", err)
+			return nil, fmt.Errorf("error ejecutando la consulta: %v", err)
 		}
 
 		for i, permission := range query.Organization.Team.Repositories.Nodes {
 			teamPermissionInfo := TeamPermission{
 				Repo:   string(permission.Name),
 				Access: string(query.Organization.Team.Repositories.Edges[i].Permission),
-				Slug:   slug.Name,
+				Slug:   slug,
 			}
 
 			teamPermissions = append(teamPermissions, teamPermissionInfo)
 		}
 
 		if !query.Organization.Team.Repositories.PageInfo.HasNextPage {
-			break TeamPermissions
+			break
 		}
 
 		repoCursor = &query.Organization.Team.Repositories.PageInfo.EndCursor
 	}
 
-RepoPermissions:
+	return teamPermissions, nil
+}
+
+// getRepoCollaborators fetches the collaborators of a repository after
+// collabCursor, or from the first page when collabCursor is nil.
+func getRepoCollaborators(ctx context.Context, client *githubv4.Client, organization string, repo string, collabCursor *githubv4.String) ([]UserPermission, error) {
+	var userPermissions []UserPermission
+	cursor := collabCursor
+
 	for {
+		var query RepoCollaboratorQuery
 
-		var query RepoPermissionQuery
 		variables := map[string]interface{}{
 			"org":          githubv4.String(organization),
-			"repoCursor":   repoCursor,
-			"collabCursor": collabCursor,
+			"repo":         githubv4.String(repo),
+			"collabCursor": cursor,
 		}
 
 		err := client.Query(ctx, &query, variables)
 		if err != nil {
-			return PermissionsInfo{}, fmt.Errorf("error ejecutando la consulta: %v", err)
+			return nil, fmt.Errorf("error ejecutando la consulta: %v", err)
 		}
 
-		for _, repo := range query.Organization.Repositories.Edges {
-
-		RepoMemberLoop:
-			for {
-				for _, member := range repo.Node.Collaborators.Edges {
-
-					userPermissionInfo := UserPermission{
-						Repo:   string(repo.Node.Name),
-						Access: string(member.Permission),
-						Login:  string(member.Node.Login),
-					}
-
-					userPermissions = append(userPermissions, userPermissionInfo)
-				}
-
-				if !repo.Node.Collaborators.PageInfo.HasNextPage {
-					break RepoMemberLoop
-				}
-				collabCursor = &repo.Node.Collaborators.PageInfo.EndCursor
-
-				variables := map[string]interface{}{
-					"org":          githubv4.String(organization),
-					"repoCursor":   repoCursor,
-					"collabCursor": collabCursor,
-				}
-
-				err := client.Query(ctx, &query, variables)
-				if err != nil {
-					return PermissionsInfo{}, fmt.Errorf("error ejecutando la consulta: %v", err)
-				}
-
-			}
+		for _, member := range query.Repository.Collaborators.Edges {
+			userPermissions = append(userPermissions, UserPermission{
+				Repo:   repo,
+				Access: string(member.Permission),
+				Login:  string(member.Node.Login),
+			})
 		}
 
-		if !query.Organization.Repositories.PageInfo.HasNextPage {
-			break RepoPermissions
+		if !query.Repository.Collaborators.PageInfo.HasNextPage {
+			break
 		}
 
-		repoCursor = &query.Organization.Repositories.PageInfo.EndCursor
-		collabCursor = nil
+		cursor = &query.Repository.Collaborators.PageInfo.EndCursor
 	}
 
-	return PermissionsInfo{Teams: teamPermissions, Users: userPermissions}, nil
+	return userPermissions, nil
 }
 
-// LoadConfig loads the configuration from a YAML file.
+// LoadConfig loads the configuration from a file in the format of its extension.
 func LoadConfig(filename string) (*AccessConfig, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
 	var config AccessConfig
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
+	if err := decodeFile(filename, &config); err != nil {
 		return nil, err
 	}
 	return &config, nil
 }
 
+// SaveConfig writes config to filename in the aac format, adding the
+// extension of the format.
 func SaveConfig(filename string, config *AccessConfig) error {
-
-	var data []byte
-	var err error
-
-	if aacFormatType == "json" {
-		filename = filename + ".json"
-		data, err = json.MarshalIndent(config, "", "  ")
-		if err != nil {
-			return fmt.Errorf("error al convertir a JSON: %w", err)
-		}
-	} else {
-		filename = filename + ".yaml"
-		data, err = yaml.Marshal(config)
-		if err != nil {
-			return err
-		}
+	format, err := currentFormat()
+	if err != nil {
+		return err
 	}
-	err = os.WriteFile(filename, data, 0644)
+	return saveFile(filename, config, format)
+}
+
+// saveFile writes v to filename in format, adding the extension of the format.
+func saveFile(filename string, v interface{}, format *aacFormat) error {
+	data, err := format.Encode(v)
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.WriteFile(filename+format.Extensions[0], data, 0644)
+}
+
+// marshalConfig encodes v in the format named format.
+func marshalConfig(v interface{}, format string) ([]byte, error) {
+	f, ok := lookupFormat(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown aac format %q", format)
+	}
+	return f.Encode(v)
+}
+
+// configFormat returns the format of an access configuration file from its extension.
+func configFormat(filename string) string {
+	return formatForFile(filename).Name
 }
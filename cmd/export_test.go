@@ -0,0 +1,437 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shurcooL/githubv4"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// assertSameConfig compares two access configurations by their YAML output,
+// which is what users diff.
+func assertSameConfig(t *testing.T, got *AccessConfig, want *AccessConfig) {
+	t.Helper()
+	gotYAML, err := yaml.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantYAML, err := yaml.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotYAML) != string(wantYAML) {
+		t.Errorf("exported config differs from the fixture\ngot:\n%s\nwant:\n%s", gotYAML, wantYAML)
+	}
+}
+
+func TestExportOrganization(t *testing.T) {
+	want := loadFixture(t, "acme.yaml")
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.identities["acme"] = []IdentityInfo{
+		{Login: "alice", NameID: "alice@acme.example", Emails: []string{"alice@acme.example"}},
+	}
+
+	got, identityMap, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	assertSameConfig(t, got, want)
+
+	if len(identityMap.Identities) != 1 || identityMap.Identities[0].Login != "alice" {
+		t.Errorf("identity map = %+v, want alice only", identityMap.Identities)
+	}
+}
+
+func TestGetTeamsPaginatesMembersAndChildTeams(t *testing.T) {
+	want := loadFixture(t, "acme.yaml")
+	f := newFakeGitHub(t, 1, loadFixture(t, "acme.yaml"))
+	p := f.provider().(*githubProvider)
+
+	teams, err := getTeams(context.Background(), p.client, "acme")
+	if err != nil {
+		t.Fatalf("getTeams: %v", err)
+	}
+	if len(teams) != len(want.Teams) {
+		t.Fatalf("got %d teams, want %d", len(teams), len(want.Teams))
+	}
+	for i, team := range teams {
+		if !reflect.DeepEqual(team.Members, want.Teams[i].Members) {
+			t.Errorf("team %s members = %v, want %v", team.Slug, team.Members, want.Teams[i].Members)
+		}
+		if !reflect.DeepEqual(team.ChildTeams, want.Teams[i].ChildTeams) {
+			t.Errorf("team %s child teams = %v, want %v", team.Slug, team.ChildTeams, want.Teams[i].ChildTeams)
+		}
+	}
+
+	// Backend and engineering have 2 immediate members: one more page of
+	// members each. Engineering has 3 child teams: two more pages.
+	if got := f.count("teamMembers"); got != 2 {
+		t.Errorf("served %d member pages, want 2", got)
+	}
+	if got := f.count("childTeams"); got != 2 {
+		t.Errorf("served %d child team pages, want 2", got)
+	}
+}
+
+func TestGetPermissionsPaginates(t *testing.T) {
+	want := loadFixture(t, "acme.yaml")
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	provider := f.provider()
+	ctx := context.Background()
+
+	teams, err := provider.Teams(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := provider.Repos(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permissions, err := getPermissions(ctx, newWorkerPool(2), provider, "acme", teams, repos, nil)
+	if err != nil {
+		t.Fatalf("getPermissions: %v", err)
+	}
+	if !reflect.DeepEqual(permissions.Teams, want.Permissions.Teams) {
+		t.Errorf("team permissions = %+v\nwant %+v", permissions.Teams, want.Permissions.Teams)
+	}
+	if !reflect.DeepEqual(permissions.Users, want.Permissions.Users) {
+		t.Errorf("user permissions = %+v\nwant %+v", permissions.Users, want.Permissions.Users)
+	}
+
+	// api has 4 collaborators: the second page is fetched on its own.
+	if got := f.count("repoCollaborators"); got != 1 {
+		t.Errorf("served %d extra collaborator pages, want 1", got)
+	}
+	// 5 repositories in pages of 2.
+	if got := f.count("collaborators"); got != 3 {
+		t.Errorf("served %d repository pages of collaborators, want 3", got)
+	}
+}
+
+func TestGetRepoCollaboratorsFromCursor(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	p := f.provider().(*githubProvider)
+
+	collaborators, err := getRepoCollaborators(context.Background(), p.client, "acme", "api", githubv4.NewString("2"))
+	if err != nil {
+		t.Fatalf("getRepoCollaborators: %v", err)
+	}
+	var logins []string
+	for _, collaborator := range collaborators {
+		logins = append(logins, collaborator.Login)
+	}
+	if want := []string{"carol", "outsider"}; !reflect.DeepEqual(logins, want) {
+		t.Errorf("collaborators after cursor = %v, want %v", logins, want)
+	}
+}
+
+func TestExportOrganizationReusesCache(t *testing.T) {
+	want := loadFixture(t, "acme.yaml")
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+
+	first, _, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("cache-dir", t.TempDir())
+	t.Cleanup(func() { viper.Set("cache-dir", "") })
+	if err := saveExportCache("acme", first); err != nil {
+		t.Fatal(err)
+	}
+	cache := loadExportCache("acme")
+	if cache == nil {
+		t.Fatal("the export cache was not saved")
+	}
+
+	// Only the web repository and the backend team changed.
+	f.updatedAt["web"] = "2023-02-01T00:00:00Z"
+	f.updatedAt["backend"] = "2023-02-01T00:00:00Z"
+	teamPermissions, collaborators := f.count("teamPermissions"), f.count("repoCollaborators")
+
+	second, _, err := exportWithFake(t, f, "acme", cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameConfig(t, second, want)
+
+	if got := f.count("teamPermissions") - teamPermissions; got != 1 {
+		t.Errorf("served %d team permission pages, want 1 for backend", got)
+	}
+	if got := f.count("repoCollaborators") - collaborators; got != 1 {
+		t.Errorf("served %d collaborator pages, want 1 for web", got)
+	}
+	if got := f.count("collaborators"); got != 3 {
+		t.Errorf("the incremental export listed collaborators by page %d times, want none", got-3)
+	}
+}
+
+func TestExportOrganizationErrors(t *testing.T) {
+	tests := []struct {
+		failure string
+		wantErr string
+	}{
+		{failure: "members", wantErr: "members"},
+		{failure: "teams", wantErr: "teams"},
+		{failure: "teamPermissions", wantErr: "permissions"},
+		{failure: "collaborators", wantErr: "permissions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.failure, func(t *testing.T) {
+			f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+			f.failures[tt.failure] = "something went wrong"
+
+			_, _, err := exportWithFake(t, f, "acme", nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "something went wrong") {
+				t.Errorf("error %q does not mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExportOrganizationSkipsForbiddenIdentities(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.identities["acme"] = []IdentityInfo{{Login: "alice", NameID: "alice@acme.example"}}
+	f.failures["identities"] = "Your token has not been granted the required scopes to execute this query. The 'samlIdentityProvider' field requires one of the following scopes: ['admin:org']"
+
+	got, identityMap, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	if len(got.Members) == 0 || len(identityMap.Identities) != 0 {
+		t.Errorf("members = %d, identities = %+v, want the members and no identities", len(got.Members), identityMap.Identities)
+	}
+
+	f.failures["identities"] = "something went wrong"
+	if _, _, err := exportWithFake(t, f, "acme", nil); err == nil || !strings.Contains(err.Error(), "external identities") {
+		t.Errorf("error = %v, want one about the external identities", err)
+	}
+}
+
+func TestExportOrganizationUnknownOrganization(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+
+	if _, _, err := exportWithFake(t, f, "umbrella", nil); err == nil {
+		t.Fatal("expected an error for an unknown organization")
+	}
+}
+
+func TestExportOrganizationSkipsForbiddenWebhooks(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.forbidden = append(f.forbidden, "repos/acme/api/hooks", "orgs/acme/hooks")
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	got, _, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	if len(got.Webhooks.Organization) != 0 || len(got.Webhooks.Repositories) != 0 {
+		t.Errorf("webhooks = %+v, want none", got.Webhooks)
+	}
+	for _, want := range []string{"/orgs/acme/hooks", "admin:org_hook", "/repos/acme/api/hooks", "read:repo_hook"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("the 403 warnings do not mention %q:\n%s", want, logs.String())
+		}
+	}
+}
+
+func TestSkipUnavailable(t *testing.T) {
+	tests := map[int]bool{http.StatusNotFound: true, http.StatusForbidden: true, http.StatusInternalServerError: false}
+	for status, want := range tests {
+		err := &RESTError{Method: http.MethodGet, URL: "https://api.github.com/orgs/acme", StatusCode: status}
+		if got := skipUnavailable(err, "the read:org scope"); got != want {
+			t.Errorf("skipUnavailable(%d) = %v, want %v", status, got, want)
+		}
+		if got := isNotFound(err); got != (status == http.StatusNotFound) {
+			t.Errorf("isNotFound(%d) = %v", status, got)
+		}
+	}
+}
+
+func TestExportConfigWritesOneFilePerOrganization(t *testing.T) {
+	umbrella := loadFixture(t, "acme.yaml")
+	umbrella.Organization.Login = "umbrella"
+	umbrella.Organization.Name = "Umbrella"
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"), umbrella)
+
+	dir := t.TempDir()
+	viper.Set("cache-dir", filepath.Join(dir, "cache"))
+	t.Cleanup(func() { viper.Set("cache-dir", "") })
+	chdir(t, dir)
+
+	exportConfig([]string{"acme", "umbrella"}, false)
+
+	for _, org := range []string{"acme", "umbrella"} {
+		config, err := LoadConfig(filepath.Join(dir, "access-config-"+org+".yaml"))
+		if err != nil {
+			t.Fatalf("loading the export of %s: %v", org, err)
+		}
+		assertSameConfig(t, config, f.orgs[org])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cache", "127.0.0.1_"+strings.Split(f.Listener.Addr().String(), ":")[1], "acme.json")); err != nil {
+		t.Errorf("the export cache was not written: %v", err)
+	}
+}
+
+func TestExportUserPermissionsAreDirectOnly(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+
+	got, _, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	if want := f.orgs["acme"].Permissions.Users; !reflect.DeepEqual(got.Permissions.Users, want) {
+		t.Errorf("user permissions = %+v, want the direct ones %+v", got.Permissions.Users, want)
+	}
+	// bob reaches web through engineering and alice every repository as an
+	// owner, which are not direct grants.
+	for _, permission := range got.Permissions.Users {
+		if (permission.Login == "bob" && permission.Repo == "web") || (permission.Login == "alice" && permission.Repo == "docs") {
+			t.Errorf("%s on %s was exported as a direct grant", permission.Login, permission.Repo)
+		}
+	}
+}
+
+func TestResolveUserWithOneIdentityMapPerOrganization(t *testing.T) {
+	umbrella := loadFixture(t, "acme.yaml")
+	umbrella.Organization.Login = "umbrella"
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"), umbrella)
+	f.identities["acme"] = []IdentityInfo{{Login: "alice", NameID: "alice@acme.example"}}
+	f.identities["umbrella"] = []IdentityInfo{{Login: "bob", NameID: "robert@umbrella.example"}}
+
+	dir := t.TempDir()
+	viper.Set("cache-dir", filepath.Join(dir, "cache"))
+	t.Cleanup(func() { viper.Set("cache-dir", "") })
+	chdir(t, dir)
+
+	exportConfig([]string{"acme", "umbrella"}, false)
+
+	tests := []struct {
+		organization string
+		value        string
+		want         string
+	}{
+		{"acme", "alice@acme.example", "alice"},
+		{"umbrella", "robert@umbrella.example", "bob"},
+		// Each organization only uses its own map.
+		{"acme", "robert@umbrella.example", "robert@umbrella.example"},
+	}
+	for _, test := range tests {
+		if got := resolveUser(test.organization, test.value); got != test.want {
+			t.Errorf("resolveUser(%s, %s) = %s, want %s", test.organization, test.value, got, test.want)
+		}
+	}
+
+	// A single identity-map is used when there is none for the organization.
+	if err := os.Rename("identity-map-acme.yaml", "identity-map.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolveUser("acme", "alice@acme.example"); got != "alice" {
+		t.Errorf("resolveUser with identity-map.yaml = %s, want alice", got)
+	}
+	if got := resolveUser("umbrella", "robert@umbrella.example"); got != "bob" {
+		t.Errorf("resolveUser of umbrella = %s, want bob", got)
+	}
+}
+
+func TestExportConfigIsFullUnlessIncremental(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	dir := t.TempDir()
+	viper.Set("cache-dir", filepath.Join(dir, "cache"))
+	t.Cleanup(func() { viper.Set("cache-dir", "") })
+	chdir(t, dir)
+
+	hasZoe := func() bool {
+		t.Helper()
+		config, err := LoadConfig(filepath.Join(dir, "access-config.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, permission := range config.Permissions.Users {
+			if permission.Login == "zoe" {
+				return true
+			}
+		}
+		return false
+	}
+
+	exportConfig([]string{"acme"}, false)
+	// A new collaborator does not change the updatedAt of the repository.
+	f.orgs["acme"].Permissions.Users = append(f.orgs["acme"].Permissions.Users, UserPermission{Repo: "api", Login: "zoe", Access: "READ"})
+
+	exportConfig([]string{"acme"}, true)
+	if hasZoe() {
+		t.Error("the incremental export fetched the collaborators of the unchanged repository")
+	}
+	exportConfig([]string{"acme"}, false)
+	if !hasZoe() {
+		t.Error("the export reused the cached collaborators")
+	}
+}
+
+func TestExportConfigReportsEndpointErrors(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.forbidden = append(f.forbidden, "meta")
+	verifyEndpointOnce = sync.Once{}
+	t.Cleanup(func() { verifyEndpointOnce = sync.Once{} })
+	chdir(t, t.TempDir())
+
+	if _, err := newGitHubProvider(context.Background(), "acme"); err == nil || !strings.Contains(err.Error(), "check --endpoint") {
+		t.Errorf("error = %v, want the endpoint check", err)
+	}
+	// The export logs the error of each organization instead of exiting.
+	exportConfig([]string{"acme"}, false)
+	if _, err := os.Stat("access-config.yaml"); !os.IsNotExist(err) {
+		t.Errorf("the failed export wrote a file: %v", err)
+	}
+}
+
+// chdir changes the working directory for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
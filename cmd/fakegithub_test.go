@@ -0,0 +1,787 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// fakeUpdatedAt is the updatedAt of every repository and team unless changed.
+const fakeUpdatedAt = "2023-01-01T00:00:00Z"
+
+// fakeGitHub is an in-process GitHub serving fixture organizations through
+// the GraphQL and REST endpoints used by githubProvider. Every connection is
+// paginated with pageSize items, whatever the query asks for, so that small
+// fixtures exercise multi-page responses.
+type fakeGitHub struct {
+	*httptest.Server
+
+	pageSize int
+	orgs     map[string]*AccessConfig
+	// identities are the SAML identities of each organization.
+	identities map[string][]IdentityInfo
+	// updatedAt overrides fakeUpdatedAt by repository name or team slug.
+	updatedAt map[string]string
+	// failures maps a GraphQL query kind or a REST path suffix to the error
+	// message returned instead of data.
+	failures map[string]string
+	// installedVersion is the GitHub Enterprise Server version in meta, empty
+	// for github.com.
+	installedVersion string
+	// forbidden are REST paths answered with 403, as without the needed scope.
+	forbidden []string
+	// contributions maps logins to the day of their last contribution.
+	contributions map[string]string
+	// rest are the items of other REST list endpoints, by path.
+	rest map[string][]interface{}
+
+	// appKey, when set, makes the fake require GitHub App authentication: the
+	// app endpoints check JWTs against it and every other request needs an
+	// installation token of the organization it is about.
+	appKey *rsa.PublicKey
+	// installations maps organization logins to installation IDs.
+	installations map[string]int64
+	// tokenTTL is the lifetime of the installation tokens.
+	tokenTTL time.Duration
+	// tokens maps the issued installation tokens to their organization.
+	tokens map[string]string
+
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+// newFakeGitHub starts a fake serving orgs and points URLGRAPHQL and URLREST to it.
+func newFakeGitHub(t *testing.T, pageSize int, orgs ...*AccessConfig) *fakeGitHub {
+	t.Helper()
+
+	f := &fakeGitHub{
+		pageSize:   pageSize,
+		orgs:       make(map[string]*AccessConfig),
+		identities: make(map[string][]IdentityInfo),
+		updatedAt:  make(map[string]string),
+		failures:   make(map[string]string),
+		rest:       make(map[string][]interface{}),
+
+		contributions: make(map[string]string),
+		queries:       make(map[string]int),
+
+		installations: make(map[string]int64),
+		tokenTTL:      time.Hour,
+		tokens:        make(map[string]string),
+	}
+	for _, org := range orgs {
+		f.orgs[org.Organization.Login] = org
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", f.serveGraphQL)
+	mux.HandleFunc("/", f.serveREST)
+	f.Server = httptest.NewServer(mux)
+
+	previousGraphQL, previousREST, previousETags := URLGRAPHQL, URLREST, restETags
+	URLGRAPHQL, URLREST, restETags = f.URL+"/graphql", f.URL, nil
+	t.Cleanup(func() {
+		f.Close()
+		URLGRAPHQL, URLREST, restETags = previousGraphQL, previousREST, previousETags
+	})
+
+	return f
+}
+
+// provider returns a githubProvider talking to the fake without retries.
+func (f *fakeGitHub) provider() Provider {
+	httpClient := &http.Client{Transport: newRateLimitTransport(nil, 0)}
+	return &githubProvider{
+		client:     githubv4.NewEnterpriseClient(URLGRAPHQL, httpClient),
+		httpClient: httpClient,
+	}
+}
+
+// count returns how many times a GraphQL query kind or REST path was served.
+func (f *fakeGitHub) count(kind string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries[kind]
+}
+
+func (f *fakeGitHub) record(kind string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries[kind]++
+}
+
+func (f *fakeGitHub) updatedAtOf(name string) string {
+	if updatedAt, ok := f.updatedAt[name]; ok {
+		return updatedAt
+	}
+	return fakeUpdatedAt
+}
+
+// page returns the bounds of the page of n items after cursor, and its pageInfo.
+func (f *fakeGitHub) page(n int, cursor interface{}) (int, int, map[string]interface{}) {
+	start := 0
+	if c, ok := cursor.(string); ok {
+		start, _ = strconv.Atoi(c)
+	}
+	end := start + f.pageSize
+	if end > n {
+		end = n
+	}
+	return start, end, map[string]interface{}{
+		"endCursor":   strconv.Itoa(end),
+		"hasNextPage": end < n,
+	}
+}
+
+// graphQLKind identifies which query of enum.go a request is.
+func graphQLKind(query string) string {
+	switch {
+	case strings.Contains(query, "samlIdentityProvider"):
+		return "identities"
+	case strings.Contains(query, "branchProtectionRules"):
+		return "branchProtections"
+	case strings.Contains(query, "repository(owner"):
+		return "repoCollaborators"
+	case strings.Contains(query, "team(slug") && strings.Contains(query, "$memberCursor"):
+		return "teamMembers"
+	case strings.Contains(query, "team(slug") && strings.Contains(query, "$childTeamCursor"):
+		return "childTeams"
+	case strings.Contains(query, "team(slug"):
+		return "teamPermissions"
+	case strings.Contains(query, "teams(first"):
+		return "teams"
+	case strings.Contains(query, "contributionsCollection"):
+		return "memberActivity"
+	case strings.Contains(query, "membersWithRole"):
+		return "members"
+	case strings.Contains(query, "collaborators("):
+		return "collaborators"
+	case strings.Contains(query, "repositories("):
+		return "repos"
+	default:
+		return "organization"
+	}
+}
+
+func (f *fakeGitHub) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	kind := graphQLKind(request.Query)
+	f.record(kind)
+	vars := request.Variables
+
+	if message, ok := f.failures[kind]; ok {
+		writeJSON(w, map[string]interface{}{"errors": []map[string]interface{}{{"message": message}}})
+		return
+	}
+
+	org, ok := f.orgs[fmt.Sprint(vars["org"])]
+	if !ok {
+		writeJSON(w, map[string]interface{}{"errors": []map[string]interface{}{{"message": "Could not resolve to an Organization"}}})
+		return
+	}
+	if !f.authorized(r, org.Organization.Login) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]interface{}{"message": "Bad credentials"})
+		return
+	}
+
+	var data map[string]interface{}
+	switch kind {
+	case "organization":
+		data = map[string]interface{}{"organization": map[string]interface{}{
+			"id":          org.Organization.ID,
+			"name":        org.Organization.Name,
+			"login":       org.Organization.Login,
+			"description": org.Organization.Description,
+			"url":         org.Organization.URL,
+		}}
+	case "repos":
+		start, end, pageInfo := f.page(len(org.Repositories), vars["afterCursor"])
+		var edges []interface{}
+		for _, repo := range org.Repositories[start:end] {
+			edges = append(edges, map[string]interface{}{"node": map[string]interface{}{
+				"name": repo.Name, "url": repo.URL, "updatedAt": f.updatedAtOf(repo.Name),
+			}})
+		}
+		data = orgData("repositories", map[string]interface{}{"edges": edges, "pageInfo": pageInfo})
+	case "teams":
+		start, end, pageInfo := f.page(len(org.Teams), vars["teamCursor"])
+		var edges []interface{}
+		for _, team := range org.Teams[start:end] {
+			edges = append(edges, map[string]interface{}{"node": map[string]interface{}{
+				"name":        team.Name,
+				"slug":        team.Slug,
+				"databaseId":  team.DatabaseID,
+				"description": team.Description,
+				"privacy":     team.Privacy,
+				"updatedAt":   f.updatedAtOf(team.Slug),
+				"members":     f.teamMemberConnection(org, &team, request.Query, nil),
+				"childTeams":  f.nameConnection(team.ChildTeams, nil),
+			}})
+		}
+		data = orgData("teams", map[string]interface{}{"edges": edges, "pageInfo": pageInfo})
+	case "teamMembers":
+		team := findTeam(org, fmt.Sprint(vars["slug"]))
+		data = orgData("team", map[string]interface{}{"members": f.teamMemberConnection(org, team, request.Query, vars["memberCursor"])})
+	case "childTeams":
+		team := findTeam(org, fmt.Sprint(vars["slug"]))
+		data = orgData("team", map[string]interface{}{"childTeams": f.nameConnection(team.ChildTeams, vars["childTeamCursor"])})
+	case "teamPermissions":
+		var permissions []TeamPermission
+		for _, permission := range org.Permissions.Teams {
+			if permission.Slug == fmt.Sprint(vars["slug"]) {
+				permissions = append(permissions, permission)
+			}
+		}
+		start, end, pageInfo := f.page(len(permissions), vars["repoCursor"])
+		var nodes, edges []interface{}
+		for _, permission := range permissions[start:end] {
+			nodes = append(nodes, map[string]interface{}{"name": permission.Repo})
+			edges = append(edges, map[string]interface{}{"permission": permission.Access})
+		}
+		data = orgData("team", map[string]interface{}{"repositories": map[string]interface{}{
+			"nodes": nodes, "edges": edges, "pageInfo": pageInfo,
+		}})
+	case "members":
+		start, end, pageInfo := f.page(len(org.Members), vars["afterCursor"])
+		var edges []interface{}
+		for _, member := range org.Members[start:end] {
+			edges = append(edges, map[string]interface{}{"role": member.Role, "node": map[string]interface{}{"login": member.Login}})
+		}
+		data = orgData("membersWithRole", map[string]interface{}{"edges": edges, "pageInfo": pageInfo})
+	case "memberActivity":
+		start, end, pageInfo := f.page(len(org.Members), vars["afterCursor"])
+		from := fmt.Sprint(vars["from"])[:len("2006-01-02")]
+		var edges []interface{}
+		for _, member := range org.Members[start:end] {
+			days := []interface{}{}
+			if day, ok := f.contributions[member.Login]; ok && day >= from {
+				days = append(days, map[string]interface{}{"date": day, "contributionCount": 1})
+			}
+			edges = append(edges, map[string]interface{}{"role": member.Role, "node": map[string]interface{}{
+				"login": member.Login,
+				"contributionsCollection": map[string]interface{}{"contributionCalendar": map[string]interface{}{
+					"weeks": []interface{}{map[string]interface{}{"contributionDays": days}},
+				}},
+			}})
+		}
+		data = orgData("membersWithRole", map[string]interface{}{"edges": edges, "pageInfo": pageInfo})
+	case "collaborators":
+		start, end, pageInfo := f.page(len(org.Repositories), vars["repoCursor"])
+		var edges []interface{}
+		for _, repo := range org.Repositories[start:end] {
+			edges = append(edges, map[string]interface{}{"node": map[string]interface{}{
+				"name":          repo.Name,
+				"collaborators": f.collaboratorConnection(org, repo.Name, request.Query, nil),
+			}})
+		}
+		data = orgData("repositories", map[string]interface{}{"edges": edges, "pageInfo": pageInfo})
+	case "branchProtections":
+		var rules []BranchProtectionInfo
+		for _, rule := range org.BranchProtections {
+			if rule.Repo == fmt.Sprint(vars["repo"]) {
+				rules = append(rules, rule)
+			}
+		}
+		start, end, pageInfo := f.page(len(rules), vars["afterCursor"])
+		var nodes []interface{}
+		for _, rule := range rules[start:end] {
+			var allowances []interface{}
+			for _, login := range rule.BypassUsers {
+				allowances = append(allowances, map[string]interface{}{"actor": map[string]interface{}{"login": login}})
+			}
+			for _, slug := range rule.BypassTeams {
+				allowances = append(allowances, map[string]interface{}{"actor": map[string]interface{}{"slug": slug}})
+			}
+			nodes = append(nodes, map[string]interface{}{
+				"pattern":                     rule.Pattern,
+				"bypassPullRequestAllowances": map[string]interface{}{"nodes": allowances},
+				"bypassForcePushAllowances":   map[string]interface{}{"nodes": []interface{}{}},
+			})
+		}
+		data = map[string]interface{}{"repository": map[string]interface{}{"branchProtectionRules": map[string]interface{}{
+			"nodes": nodes, "pageInfo": pageInfo,
+		}}}
+	case "repoCollaborators":
+		data = map[string]interface{}{"repository": map[string]interface{}{
+			"collaborators": f.collaboratorConnection(org, fmt.Sprint(vars["repo"]), request.Query, vars["collabCursor"]),
+		}}
+	case "identities":
+		identities, ok := f.identities[org.Organization.Login]
+		if !ok {
+			data = orgData("samlIdentityProvider", nil)
+			break
+		}
+		start, end, pageInfo := f.page(len(identities), vars["afterCursor"])
+		var edges []interface{}
+		for _, identity := range identities[start:end] {
+			var emails []interface{}
+			for _, email := range identity.Emails {
+				emails = append(emails, map[string]interface{}{"value": email})
+			}
+			edges = append(edges, map[string]interface{}{"node": map[string]interface{}{
+				"samlIdentity": map[string]interface{}{"nameId": identity.NameID, "emails": emails},
+				"scimIdentity": map[string]interface{}{"username": identity.SCIMUsername, "emails": nil},
+				"user":         map[string]interface{}{"login": identity.Login},
+			}})
+		}
+		data = orgData("samlIdentityProvider", map[string]interface{}{"externalIdentities": map[string]interface{}{
+			"edges": edges, "pageInfo": pageInfo,
+		}})
+	}
+
+	data["rateLimit"] = map[string]interface{}{"cost": 1, "remaining": 4999, "resetAt": "2030-01-01T00:00:00Z"}
+	writeJSON(w, map[string]interface{}{"data": data})
+}
+
+func orgData(field string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"organization": map[string]interface{}{field: value}}
+}
+
+// teamMemberConnection returns the members of team, which are the immediate
+// ones of the configuration. Like GitHub, it adds the members of the child
+// teams unless the query asks for membership: IMMEDIATE.
+func (f *fakeGitHub) teamMemberConnection(org *AccessConfig, team *TeamInfo, query string, cursor interface{}) map[string]interface{} {
+	logins := team.Members
+	if !strings.Contains(query, "membership: IMMEDIATE") {
+		logins = nil
+		for _, login := range teamMembers(org, team.Slug) {
+			if !containsFold(logins, login) {
+				logins = append(logins, login)
+			}
+		}
+		sort.Strings(logins)
+	}
+	start, end, pageInfo := f.page(len(logins), cursor)
+	var edges []interface{}
+	for _, login := range logins[start:end] {
+		role := "MEMBER"
+		if containsFold(team.Maintainers, login) {
+			role = "MAINTAINER"
+		}
+		edges = append(edges, map[string]interface{}{"role": role, "node": map[string]interface{}{"login": login}})
+	}
+	return map[string]interface{}{"edges": edges, "pageInfo": pageInfo}
+}
+
+func (f *fakeGitHub) nameConnection(names []string, cursor interface{}) map[string]interface{} {
+	start, end, pageInfo := f.page(len(names), cursor)
+	var edges []interface{}
+	for _, name := range names[start:end] {
+		edges = append(edges, map[string]interface{}{"node": map[string]interface{}{"name": name}})
+	}
+	return map[string]interface{}{"edges": edges, "pageInfo": pageInfo}
+}
+
+// collaboratorConnection returns the direct collaborators of repo when the
+// query asks for affiliation: DIRECT. Otherwise, like GitHub, it returns
+// everyone with access, through teams, the owner role or the base permission
+// included, with their highest permission.
+func (f *fakeGitHub) collaboratorConnection(org *AccessConfig, repo string, query string, cursor interface{}) map[string]interface{} {
+	var permissions []UserPermission
+	if strings.Contains(query, "affiliation: DIRECT") {
+		for _, permission := range org.Permissions.Users {
+			if permission.Repo == repo {
+				permissions = append(permissions, permission)
+			}
+		}
+	} else {
+		for _, permission := range resolveRepoPermissions(org, repo) {
+			permissions = append(permissions, UserPermission{Repo: repo, Login: permission.Login, Access: permission.Access})
+		}
+	}
+
+	start, end, pageInfo := f.page(len(permissions), cursor)
+	var edges []interface{}
+	for _, permission := range permissions[start:end] {
+		edges = append(edges, map[string]interface{}{
+			"node":       map[string]interface{}{"login": permission.Login},
+			"permission": permission.Access,
+		})
+	}
+	return map[string]interface{}{"edges": edges, "pageInfo": pageInfo}
+}
+
+func (f *fakeGitHub) serveREST(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	f.record(r.Method + " " + path)
+
+	for suffix, message := range f.failures {
+		if strings.HasSuffix(path, suffix) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			writeJSON(w, map[string]interface{}{"message": message})
+			return
+		}
+	}
+
+	for _, forbidden := range f.forbidden {
+		if path == forbidden {
+			w.WriteHeader(http.StatusForbidden)
+			writeJSON(w, map[string]interface{}{"message": "Must have admin rights to Repository."})
+			return
+		}
+	}
+
+	if path == "meta" {
+		meta := map[string]interface{}{"verifiable_password_authentication": false}
+		if f.installedVersion != "" {
+			meta["installed_version"] = f.installedVersion
+		}
+		writeJSON(w, meta)
+		return
+	}
+
+	if len(parts) == 4 && parts[0] == "app" && parts[3] == "access_tokens" {
+		f.serveAccessToken(w, r, parts[2])
+		return
+	}
+
+	if len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	org, ok := f.orgs[parts[1]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if parts[0] == "orgs" && len(parts) == 3 && parts[2] == "installation" {
+		id, ok := f.installations[parts[1]]
+		if !f.validJWT(r) || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"id": id})
+		return
+	}
+	if !f.authorized(r, parts[1]) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]interface{}{"message": "Bad credentials"})
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[0] == "orgs":
+		if org.Organization.DefaultRepositoryPermission == "" {
+			writeJSON(w, map[string]interface{}{"login": org.Organization.Login})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"login":                         org.Organization.Login,
+			"default_repository_permission": strings.ToLower(org.Organization.DefaultRepositoryPermission),
+		})
+	case len(parts) == 2:
+		http.NotFound(w, r)
+	case parts[0] == "orgs" && parts[2] == "hooks":
+		f.writeRESTPage(w, r, webhooksJSON(org.Webhooks.Organization))
+	case parts[0] == "repos" && len(parts) == 4 && parts[3] == "hooks":
+		var hooks []WebhookInfo
+		for _, hook := range org.Webhooks.Repositories {
+			if hook.Repo == parts[2] {
+				hooks = append(hooks, hook)
+			}
+		}
+		f.writeRESTPage(w, r, webhooksJSON(hooks))
+	case parts[0] == "repos" && len(parts) == 4 && parts[3] == "environments":
+		environments := []interface{}{}
+		for _, environment := range org.Environments {
+			if environment.Repo != parts[2] {
+				continue
+			}
+			var reviewers []interface{}
+			for _, login := range environment.Users {
+				reviewers = append(reviewers, map[string]interface{}{"type": "User", "reviewer": map[string]interface{}{"login": login}})
+			}
+			for _, slug := range environment.Teams {
+				reviewers = append(reviewers, map[string]interface{}{"type": "Team", "reviewer": map[string]interface{}{"slug": slug}})
+			}
+			environments = append(environments, map[string]interface{}{
+				"name": environment.Name,
+				"protection_rules": []interface{}{
+					map[string]interface{}{"type": "wait_timer", "wait_timer": 5},
+					map[string]interface{}{"type": "required_reviewers", "reviewers": reviewers},
+				},
+			})
+		}
+		writeJSON(w, map[string]interface{}{"total_count": len(environments), "environments": environments})
+	case parts[2] == "security-managers" && r.Method == http.MethodGet:
+		var teams []interface{}
+		for _, slug := range org.SecurityManagers {
+			teams = append(teams, map[string]interface{}{"slug": slug})
+		}
+		f.writeRESTPage(w, r, teams)
+	case parts[2] == "security-managers" && len(parts) == 5:
+		f.mu.Lock()
+		if r.Method == http.MethodPut {
+			org.SecurityManagers = append(org.SecurityManagers, parts[4])
+		} else {
+			_, org.SecurityManagers = diffStrings(org.SecurityManagers, []string{parts[4]})
+		}
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case path == fmt.Sprintf("orgs/%s/organization-roles", parts[1]):
+		writeJSON(w, map[string]interface{}{"roles": []interface{}{map[string]interface{}{"id": 1, "name": "moderator"}}})
+	case len(parts) == 6 && parts[2] == "organization-roles" && parts[5] == "1":
+		// orgs/<org>/organization-roles/(users|teams)/<name>/1
+		f.mu.Lock()
+		holders := &org.Moderators.Users
+		if parts[3] == "teams" {
+			holders = &org.Moderators.Teams
+		}
+		if r.Method == http.MethodPut {
+			*holders = append(*holders, parts[4])
+		} else {
+			_, *holders = diffStrings(*holders, []string{parts[4]})
+		}
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(path, "organization-roles/1/users"):
+		var users []interface{}
+		for _, login := range org.Moderators.Users {
+			users = append(users, map[string]interface{}{"login": login})
+		}
+		f.writeRESTPage(w, r, users)
+	case strings.HasSuffix(path, "organization-roles/1/teams"):
+		var teams []interface{}
+		for _, slug := range org.Moderators.Teams {
+			teams = append(teams, map[string]interface{}{"slug": slug})
+		}
+		f.writeRESTPage(w, r, teams)
+	case strings.HasSuffix(path, "team-sync/groups"):
+		var groups []interface{}
+		for _, team := range org.Teams {
+			for _, group := range team.IdPGroups {
+				groups = append(groups, map[string]interface{}{"group_id": group.ID, "group_name": group.Name, "group_description": group.Description})
+			}
+		}
+		if len(groups) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"groups": groups})
+	case strings.HasSuffix(path, "team-sync/group-mappings"):
+		team := findTeam(org, parts[3])
+		if team == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			var body restIdPGroupList
+			json.NewDecoder(r.Body).Decode(&body)
+			f.mu.Lock()
+			team.IdPGroups = toIdPGroupInfos(body.Groups)
+			team.IdPManaged = len(team.IdPGroups) > 0
+			f.mu.Unlock()
+		}
+		groups := []interface{}{}
+		for _, group := range team.IdPGroups {
+			groups = append(groups, map[string]interface{}{"group_id": group.ID, "group_name": group.Name, "group_description": group.Description})
+		}
+		writeJSON(w, map[string]interface{}{"groups": groups})
+	case strings.HasSuffix(path, "/audit-log") && f.rest[path] != nil:
+		writeJSON(w, auditLogPage(f.rest[path], r.URL.Query()))
+	case f.rest[path] != nil:
+		f.writeRESTPage(w, r, f.rest[path])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized reports whether r carries credentials valid for organization.
+// Without appKey, any credentials are.
+func (f *fakeGitHub) authorized(r *http.Request, organization string) bool {
+	if f.appKey == nil {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] == organization
+}
+
+// validJWT reports whether r is authenticated with a JWT signed by the app key.
+func (f *fakeGitHub) validJWT(r *http.Request) bool {
+	if f.appKey == nil {
+		return false
+	}
+	parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return rsa.VerifyPKCS1v15(f.appKey, crypto.SHA256, digest[:], signature) == nil
+}
+
+// serveAccessToken issues an installation token, like
+// POST /app/installations/{id}/access_tokens.
+func (f *fakeGitHub) serveAccessToken(w http.ResponseWriter, r *http.Request, installationID string) {
+	if r.Method != http.MethodPost || !f.validJWT(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJSON(w, map[string]interface{}{"message": "A JSON web token could not be decoded"})
+		return
+	}
+
+	for login, id := range f.installations {
+		if strconv.FormatInt(id, 10) != installationID {
+			continue
+		}
+		f.mu.Lock()
+		token := fmt.Sprintf("ghs_%s_%d", login, len(f.tokens)+1)
+		f.tokens[token] = login
+		f.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, map[string]interface{}{
+			"token":      token,
+			"expires_at": time.Now().Add(f.tokenTTL).UTC().Format(time.RFC3339),
+		})
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func webhooksJSON(hooks []WebhookInfo) []interface{} {
+	var items []interface{}
+	for _, hook := range hooks {
+		insecureSSL := "0"
+		if !hook.SSLVerify {
+			insecureSSL = "1"
+		}
+		items = append(items, map[string]interface{}{
+			"active": hook.Active,
+			"events": hook.Events,
+			"config": map[string]interface{}{
+				"url":          "https://" + hook.Host + "/hook?token=secret",
+				"content_type": hook.ContentType,
+				"insecure_ssl": insecureSSL,
+				"secret":       "********",
+			},
+		})
+	}
+	return items
+}
+
+// auditLogPage returns the audit log entries of the actor: of the phrase in
+// query, newest first and limited to per_page, like the GitHub audit log API.
+func auditLogPage(entries []interface{}, query url.Values) []interface{} {
+	var actor string
+	for _, term := range strings.Fields(query.Get("phrase")) {
+		if strings.HasPrefix(term, "actor:") {
+			actor = strings.TrimPrefix(term, "actor:")
+		}
+	}
+	result := []interface{}{}
+	for _, entry := range entries {
+		if actor == "" || strings.EqualFold(auditString(entry.(map[string]interface{}), "actor"), actor) {
+			result = append(result, entry)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].(map[string]interface{})["@timestamp"].(float64) > result[j].(map[string]interface{})["@timestamp"].(float64)
+	})
+	if perPage, err := strconv.Atoi(query.Get("per_page")); err == nil && perPage < len(result) {
+		result = result[:perPage]
+	}
+	return result
+}
+
+// writeRESTPage writes the page of items requested with ?page= and a Link
+// header to the next page, like the GitHub REST API does.
+func (f *fakeGitHub) writeRESTPage(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * f.pageSize
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + f.pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+
+	if end < len(items) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, f.URL, next.RequestURI()))
+	}
+
+	result := items[start:end]
+	if result == nil {
+		result = []interface{}{}
+	}
+	writeJSON(w, result)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// loadFixture loads an access configuration from testdata.
+func loadFixture(t *testing.T, name string) *AccessConfig {
+	t.Helper()
+	config, err := LoadConfig("testdata/" + name)
+	if err != nil {
+		t.Fatalf("loading fixture %s: %v", name, err)
+	}
+	return config
+}
+
+// exportWithFake exports organization from the fake through the pipeline.
+func exportWithFake(t *testing.T, f *fakeGitHub, organization string, cache *exportCache) (*AccessConfig, *IdentityMap, error) {
+	t.Helper()
+	return exportOrganization(context.Background(), newWorkerPool(4), f.provider(), organization, cache)
+}
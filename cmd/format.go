@@ -0,0 +1,191 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// aacFormat is a format of the access as code (aac) file. Formats register
+// themselves with registerFormat, so new ones are added without changing
+// SaveConfig or LoadConfig.
+type aacFormat struct {
+	// Name is the value of --aac-format. Aliases are accepted too.
+	Name    string
+	Aliases []string
+	// Extensions of the files of the format. The first one is written.
+	Extensions  []string
+	Description string
+	Encode      func(v interface{}) ([]byte, error)
+	// Decode is nil for output only formats, such as summaries, whose files
+	// cannot be read back.
+	Decode func(data []byte, v interface{}) error
+}
+
+// aacFormats holds the registered formats in registration order.
+var aacFormats []*aacFormat
+
+// registerFormat adds format to the registry. It panics when the name, an
+// alias or an extension is already registered, as that is a programming error.
+func registerFormat(format *aacFormat) {
+	if format.Name == "" || len(format.Extensions) == 0 || format.Encode == nil {
+		panic(fmt.Sprintf("format %q needs a name, an extension and an encoder", format.Name))
+	}
+	for _, name := range append([]string{format.Name}, format.Aliases...) {
+		if _, ok := lookupFormat(name); ok {
+			panic(fmt.Sprintf("format %q registered twice", name))
+		}
+	}
+	for _, extension := range format.Extensions {
+		if formatForExtension(extension) != nil {
+			panic(fmt.Sprintf("extension %q of format %q registered twice", extension, format.Name))
+		}
+	}
+	aacFormats = append(aacFormats, format)
+}
+
+// lookupFormat returns the format with name or alias name.
+func lookupFormat(name string) (*aacFormat, bool) {
+	for _, format := range aacFormats {
+		if strings.EqualFold(format.Name, name) || containsFold(format.Aliases, name) {
+			return format, true
+		}
+	}
+	return nil, false
+}
+
+// formatForExtension returns the format of the file extension, or nil.
+func formatForExtension(extension string) *aacFormat {
+	for _, format := range aacFormats {
+		if containsFold(format.Extensions, extension) {
+			return format
+		}
+	}
+	return nil
+}
+
+// formatForFile returns the format of filename from its extension, YAML when
+// the extension is unknown.
+func formatForFile(filename string) *aacFormat {
+	if format := formatForExtension(filepath.Ext(filename)); format != nil {
+		return format
+	}
+	format, _ := lookupFormat("yaml")
+	return format
+}
+
+// formatNames returns the sorted names of the registered formats.
+func formatNames() []string {
+	var names []string
+	for _, format := range aacFormats {
+		names = append(names, format.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// aacFormatUsage returns the help of --aac-format, listing the formats.
+func aacFormatUsage() string {
+	var b strings.Builder
+	b.WriteString("Format of the access as code (aac) output file, YAML by default:")
+	for _, name := range formatNames() {
+		format, _ := lookupFormat(name)
+		fmt.Fprintf(&b, "\n  %s", format.Name)
+		if len(format.Aliases) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(format.Aliases, ", "))
+		}
+		fmt.Fprintf(&b, ": %s", format.Description)
+		if format.Decode == nil {
+			b.WriteString(", output only")
+		}
+	}
+	return b.String()
+}
+
+// currentFormat returns the format of the aac-format setting, YAML when unset.
+func currentFormat() (*aacFormat, error) {
+	name := aacFormatType
+	if name == "" {
+		name = "yaml"
+	}
+	format, ok := lookupFormat(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown aac format %q: use one of %s", aacFormatType, strings.Join(formatNames(), ", "))
+	}
+	return format, nil
+}
+
+// accessConfigEncoder returns the encoder of a format that only renders
+// access configurations.
+func accessConfigEncoder(name string, render func(config *AccessConfig) string) func(v interface{}) ([]byte, error) {
+	return func(v interface{}) ([]byte, error) {
+		config, ok := v.(*AccessConfig)
+		if !ok {
+			return nil, fmt.Errorf("the %s format only encodes access configurations, not %T", name, v)
+		}
+		return []byte(render(config)), nil
+	}
+}
+
+// decodeFile reads filename into v in the format of its extension.
+func decodeFile(filename string, v interface{}) error {
+	format := formatForFile(filename)
+	if format.Decode == nil {
+		return fmt.Errorf("%s cannot be read: the %s format is output only", filename, format.Name)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return format.Decode(data, v)
+}
+
+func init() {
+	registerFormat(&aacFormat{
+		Name:        "yaml",
+		Aliases:     []string{"yml"},
+		Extensions:  []string{".yaml", ".yml"},
+		Description: "YAML",
+		Encode:      yaml.Marshal,
+		Decode:      yaml.Unmarshal,
+	})
+	registerFormat(&aacFormat{
+		Name:        "json",
+		Extensions:  []string{".json"},
+		Description: "JSON",
+		Encode: func(v interface{}) ([]byte, error) {
+			data, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("error al convertir a JSON: %w", err)
+			}
+			return data, nil
+		},
+		Decode: json.Unmarshal,
+	})
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useFormat sets the aac format for the test.
+func useFormat(t *testing.T, name string) {
+	t.Helper()
+	previous := aacFormatType
+	aacFormatType = name
+	t.Cleanup(func() { aacFormatType = previous })
+}
+
+func TestLookupFormat(t *testing.T) {
+	for name, want := range map[string]string{"yaml": "yaml", "YML": "yaml", "json": "json", "md": "markdown", "tf": "terraform"} {
+		format, ok := lookupFormat(name)
+		if !ok || format.Name != want {
+			t.Errorf("lookupFormat(%q) = %v, %v, want %s", name, format, ok, want)
+		}
+	}
+	if _, ok := lookupFormat("toml"); ok {
+		t.Error("toml is not registered")
+	}
+
+	for filename, want := range map[string]string{"a.json": "json", "a.YML": "yaml", "a.tf": "terraform", "a": "yaml", "a.txt": "yaml"} {
+		if got := configFormat(filename); got != want {
+			t.Errorf("configFormat(%q) = %s, want %s", filename, got, want)
+		}
+	}
+
+	if want := []string{"json", "markdown", "terraform", "yaml"}; !reflect.DeepEqual(formatNames(), want) {
+		t.Errorf("formatNames() = %q, want %q", formatNames(), want)
+	}
+	usage := aacFormatUsage()
+	for _, want := range []string{"\n  yaml (yml): YAML", "\n  markdown (md): summary for pull request comments and job summaries, output only"} {
+		if !strings.Contains(usage, want) {
+			t.Errorf("usage does not contain %q:\n%s", want, usage)
+		}
+	}
+
+	useFormat(t, "xml")
+	if _, err := currentFormat(); err == nil || !strings.Contains(err.Error(), "use one of json, markdown, terraform, yaml") {
+		t.Errorf("currentFormat() error = %v", err)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	previous := aacFormats
+	t.Cleanup(func() { aacFormats = previous })
+
+	registerFormat(&aacFormat{
+		Name:       "lines",
+		Extensions: []string{".lines"},
+		Encode: accessConfigEncoder("lines", func(config *AccessConfig) string {
+			var b strings.Builder
+			for _, member := range config.Members {
+				b.WriteString(member.Login + "\n")
+			}
+			return b.String()
+		}),
+	})
+	config := loadFixture(t, "acme.yaml")
+	chdir(t, t.TempDir())
+	useFormat(t, "lines")
+	if err := SaveConfig("access-config", config); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile("access-config.lines"); err != nil || !strings.HasPrefix(string(data), "alice\n") {
+		t.Errorf("access-config.lines = %q, %v", data, err)
+	}
+	if _, err := LoadConfig("access-config.lines"); err == nil {
+		t.Error("expected an error loading an output only format")
+	}
+
+	for _, format := range []*aacFormat{
+		{Name: "LINES", Extensions: []string{".other"}, Encode: previous[0].Encode},
+		{Name: "other", Extensions: []string{".YAML"}, Encode: previous[0].Encode},
+		{Name: "other", Extensions: []string{".other"}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %+v did not panic", format)
+				}
+			}()
+			registerFormat(format)
+		}()
+	}
+}
+
+func TestSaveConfigAs(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	// loadsBack checks that a file of a readable format loads back as config.
+	loadsBack := func(t *testing.T, path string, _ []byte) {
+		loaded, err := LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded, config) {
+			t.Errorf("%s does not load back", path)
+		}
+	}
+	// renders checks that a file of an output only format is render(config).
+	renders := func(render func(*AccessConfig) string) func(*testing.T, string, []byte) {
+		return func(t *testing.T, path string, data []byte) {
+			if string(data) != render(config) {
+				t.Errorf("%s is not the rendered configuration:\n%s", path, data)
+			}
+		}
+	}
+
+	tests := []struct {
+		format string
+		path   string
+		check  func(t *testing.T, path string, data []byte)
+	}{
+		{"yaml", "access-config.yaml", loadsBack},
+		{"json", "access-config.json", loadsBack},
+		{"markdown", "access-config.md", renders(renderMarkdownSummary)},
+		{"terraform", "access-config.tf", renders(renderTerraform)},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			useFormat(t, test.format)
+
+			if err := SaveConfig("access-config", config); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.check(t, test.path, data)
+		})
+	}
+}
+
+func TestSaveIdentityMapOutputOnly(t *testing.T) {
+	chdir(t, t.TempDir())
+	useFormat(t, "markdown")
+
+	identityMap := &IdentityMap{Organization: "acme", Identities: []IdentityInfo{{Login: "alice", NameID: "alice@acme.example"}}}
+	if err := SaveIdentityMap("identity-map", identityMap); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIdentityMap("identity-map.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, identityMap) {
+		t.Errorf("identity map = %+v, want %+v", loaded, identityMap)
+	}
+}
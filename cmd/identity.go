@@ -0,0 +1,194 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shurcooL/githubv4"
+	"github.com/spf13/viper"
+)
+
+func getExternalIdentities(ctx context.Context, client *githubv4.Client, organization string) ([]IdentityInfo, error) {
+	var allIdentities []IdentityInfo
+	var afterCursor *githubv4.String
+
+	for {
+		var query ExternalIdentityQuery
+
+		variables := map[string]interface{}{
+			"org":         githubv4.String(organization),
+			"afterCursor": afterCursor,
+		}
+
+		err := client.Query(ctx, &query, variables)
+		if err != nil {
+			return nil, fmt.Errorf("error ejecutando la consulta: %v", err)
+		}
+
+		identities := query.Organization.SamlIdentityProvider.ExternalIdentities
+		for _, edge := range identities.Edges {
+			// Identities not linked to a GitHub account cannot be resolved to a login.
+			if edge.Node.User.Login == "" {
+				continue
+			}
+
+			identityInfo := IdentityInfo{
+				Login:        string(edge.Node.User.Login),
+				NameID:       string(edge.Node.SamlIdentity.NameId),
+				SCIMUsername: string(edge.Node.ScimIdentity.Username),
+			}
+			for _, email := range edge.Node.SamlIdentity.Emails {
+				identityInfo.Emails = appendUnique(identityInfo.Emails, string(email.Value))
+			}
+			for _, email := range edge.Node.ScimIdentity.Emails {
+				identityInfo.Emails = appendUnique(identityInfo.Emails, string(email.Value))
+			}
+			allIdentities = append(allIdentities, identityInfo)
+		}
+
+		if !identities.PageInfo.HasNextPage {
+			break
+		}
+
+		afterCursor = &identities.PageInfo.EndCursor
+	}
+
+	return allIdentities, nil
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// SaveIdentityMap saves the identity map in the aac format, or in YAML when
+// the aac format is output only, as the identity map is read back.
+func SaveIdentityMap(filename string, identityMap *IdentityMap) error {
+	format, err := currentFormat()
+	if err != nil {
+		return err
+	}
+	if format.Decode == nil {
+		format, _ = lookupFormat("yaml")
+	}
+	return saveFile(filename, identityMap, format)
+}
+
+// LoadIdentityMap loads the identity map from a file in the format of its extension.
+func LoadIdentityMap(filename string) (*IdentityMap, error) {
+	var identityMap IdentityMap
+	if err := decodeFile(filename, &identityMap); err != nil {
+		return nil, err
+	}
+	return &identityMap, nil
+}
+
+// identityMapPath returns the identity map file of organization: the
+// identity-path setting or, by default, the identity map next to the aac
+// file, identity-map-<organization> as exported with several organizations
+// or else identity-map.
+func identityMapPath(organization string) string {
+	if path := viper.GetString("identity-path"); path != "" {
+		return path
+	}
+
+	dir := filepath.Dir(viper.GetString("aac-path"))
+	names := []string{"identity-map"}
+	if organization != "" {
+		names = []string{"identity-map-" + organization, "identity-map"}
+	}
+	for _, name := range names {
+		for _, format := range aacFormats {
+			if format.Decode == nil {
+				continue
+			}
+			for _, ext := range format.Extensions {
+				path := filepath.Join(dir, name+ext)
+				if _, err := os.Stat(path); err == nil {
+					return path
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// resolveUser returns the GitHub login for value, which may already be a
+// login or a corporate identity (SAML NameID, SCIM username or email) listed
+// in the identity map of organization. Unknown values are returned unchanged.
+func resolveUser(organization string, value string) string {
+	path := identityMapPath(organization)
+	if path == "" {
+		return value
+	}
+
+	identityMap, err := LoadIdentityMap(path)
+	if err != nil {
+		log.Printf("Failed to load identity map %s: %v\n", path, err)
+		return value
+	}
+
+	login, ok := identityMap.Resolve(value)
+	if !ok {
+		return value
+	}
+	if !strings.EqualFold(login, value) {
+		log.Printf("Resolved %s to GitHub login %s\n", value, login)
+	}
+	return login
+}
+
+// Resolve returns the GitHub login matching value by login, NameID, SCIM
+// username or email.
+func (m *IdentityMap) Resolve(value string) (string, bool) {
+	for _, identity := range m.Identities {
+		if strings.EqualFold(identity.Login, value) {
+			return identity.Login, true
+		}
+	}
+
+	for _, identity := range m.Identities {
+		if strings.EqualFold(identity.NameID, value) || strings.EqualFold(identity.SCIMUsername, value) {
+			return identity.Login, true
+		}
+		for _, email := range identity.Emails {
+			if strings.EqualFold(email, value) {
+				return identity.Login, true
+			}
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// markdownGrantRows is the most grants listed per permission level, which
+// keeps the summary of a large organization under the 65,536 characters of a
+// pull request comment.
+const markdownGrantRows = 50
+
+// renderMarkdownSummary returns a Markdown summary of config for pull request
+// comments and job summaries: counts, the risky entries and the grants by
+// permission level.
+func renderMarkdownSummary(config *AccessConfig) string {
+	var b strings.Builder
+
+	members := make(map[string]bool)
+	var owners []string
+	for _, member := range config.Members {
+		members[strings.ToLower(member.Login)] = true
+		if strings.EqualFold(member.Role, "ADMIN") {
+			owners = append(owners, member.Login)
+		}
+	}
+	var outside []UserPermission
+	outsideLogins := make(map[string]bool)
+	for _, permission := range config.Permissions.Users {
+		if !members[strings.ToLower(permission.Login)] {
+			outside = append(outside, permission)
+			outsideLogins[strings.ToLower(permission.Login)] = true
+		}
+	}
+
+	basePermission := config.Organization.DefaultRepositoryPermission
+	if basePermission == "" {
+		basePermission = "unknown"
+	}
+
+	fmt.Fprintf(&b, "# Access summary: %s\n\n", markdownCell(config.Organization.Login))
+	b.WriteString("| | Count |\n|---|---:|\n")
+	fmt.Fprintf(&b, "| Members | %d |\n", len(config.Members))
+	fmt.Fprintf(&b, "| Owners | %d |\n", len(owners))
+	fmt.Fprintf(&b, "| Teams | %d |\n", len(config.Teams))
+	fmt.Fprintf(&b, "| Repositories | %d |\n", len(config.Repositories))
+	fmt.Fprintf(&b, "| Outside collaborators | %d |\n", len(outsideLogins))
+	fmt.Fprintf(&b, "| Team grants | %d |\n", len(config.Permissions.Teams))
+	fmt.Fprintf(&b, "| User grants | %d |\n", len(config.Permissions.Users))
+	fmt.Fprintf(&b, "\nBase permission of the members: **%s**\n", basePermission)
+
+	var risky []string
+	for _, login := range owners {
+		risky = append(risky, fmt.Sprintf("**%s** is an organization owner", markdownCell(login)))
+	}
+	for _, permission := range outside {
+		risky = append(risky, fmt.Sprintf("**%s** is an outside collaborator with %s on %s", markdownCell(permission.Login), permission.Access, markdownCell(permission.Repo)))
+	}
+	for _, permission := range config.Permissions.Users {
+		// Owners are already reported and have ADMIN on every repository.
+		if strings.EqualFold(permission.Access, "ADMIN") && members[strings.ToLower(permission.Login)] && !containsFold(owners, permission.Login) {
+			risky = append(risky, fmt.Sprintf("**%s** has ADMIN on %s directly", markdownCell(permission.Login), markdownCell(permission.Repo)))
+		}
+	}
+	for _, permission := range config.Permissions.Teams {
+		if strings.EqualFold(permission.Access, "ADMIN") {
+			risky = append(risky, fmt.Sprintf("team **%s** has ADMIN on %s", markdownCell(permission.Slug), markdownCell(permission.Repo)))
+		}
+	}
+	if len(risky) > 0 {
+		b.WriteString("\n## Risky entries\n\n> [!WARNING]\n")
+		for _, entry := range risky {
+			fmt.Fprintf(&b, "> - %s\n", entry)
+		}
+	}
+
+	b.WriteString("\n## Grants by permission level\n")
+	for level := len(permissionLevels) - 1; level > 0; level-- {
+		access := permissionLevels[level]
+		var rows []string
+		for _, permission := range config.Permissions.Teams {
+			if strings.EqualFold(permission.Access, access) {
+				rows = append(rows, fmt.Sprintf("| %s | team | %s |", markdownCell(permission.Repo), markdownCell(permission.Slug)))
+			}
+		}
+		for _, permission := range config.Permissions.Users {
+			if strings.EqualFold(permission.Access, access) {
+				kind := "user"
+				if outsideLogins[strings.ToLower(permission.Login)] {
+					kind = "outside collaborator"
+				}
+				rows = append(rows, fmt.Sprintf("| %s | %s | %s |", markdownCell(permission.Repo), kind, markdownCell(permission.Login)))
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s (%d)\n\n| Repository | Grantee | Name |\n|---|---|---|\n", access, len(rows))
+		if len(rows) > markdownGrantRows {
+			b.WriteString(strings.Join(rows[:markdownGrantRows], "\n") + "\n")
+			fmt.Fprintf(&b, "\n_%d more %s grants are not listed, see the access configuration file._\n", len(rows)-markdownGrantRows, access)
+			continue
+		}
+		b.WriteString(strings.Join(rows, "\n") + "\n")
+	}
+
+	return b.String()
+}
+
+// markdownCell escapes the characters of value that would break a Markdown
+// table or its formatting.
+func markdownCell(value string) string {
+	return strings.NewReplacer("|", `\|`, "*", `\*`, "_", `\_`, "\n", " ").Replace(value)
+}
+
+func init() {
+	registerFormat(&aacFormat{
+		Name:        "markdown",
+		Aliases:     []string{"md"},
+		Extensions:  []string{".md"},
+		Description: "summary for pull request comments and job summaries",
+		Encode:      accessConfigEncoder("markdown", renderMarkdownSummary),
+	})
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownSummary(t *testing.T) {
+	summary := renderMarkdownSummary(loadFixture(t, "acme.yaml"))
+
+	for _, want := range []string{
+		"# Access summary: acme\n",
+		"| Members | 6 |\n",
+		"| Owners | 1 |\n",
+		"| Outside collaborators | 2 |\n",
+		"Base permission of the members: **READ**\n",
+		"> [!WARNING]\n> - **alice** is an organization owner\n",
+		"> - **mallory** is an outside collaborator with ADMIN on tools\n",
+		"> - **erin** has ADMIN on infra directly\n",
+		"> - team **platform** has ADMIN on infra\n",
+		"### ADMIN (4)\n\n| Repository | Grantee | Name |\n|---|---|---|\n| infra | team | platform |\n",
+		"| api | outside collaborator | outsider |\n",
+		"### MAINTAIN (1)\n",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary does not contain %q:\n%s", want, summary)
+		}
+	}
+	if strings.Contains(summary, "### TRIAGE") {
+		t.Error("summary has a section for a level without grants")
+	}
+	// Owners are not reported again for their direct ADMIN grants.
+	if strings.Contains(summary, "**alice** has ADMIN") {
+		t.Errorf("the direct ADMIN of an owner is reported:\n%s", summary)
+	}
+}
+
+func TestRenderMarkdownSummaryCapsGrants(t *testing.T) {
+	config := &AccessConfig{}
+	for i := 0; i < markdownGrantRows+7; i++ {
+		config.Permissions.Teams = append(config.Permissions.Teams, TeamPermission{Repo: fmt.Sprintf("repo-%d", i), Slug: "everyone", Access: "READ"})
+	}
+	summary := renderMarkdownSummary(config)
+
+	if got := strings.Count(summary, "| team | everyone |"); got != markdownGrantRows {
+		t.Errorf("summary lists %d grants, want %d", got, markdownGrantRows)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("### READ (%d)\n", markdownGrantRows+7),
+		"_7 more READ grants are not listed, see the access configuration file._\n",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary does not contain %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestMarkdownCell(t *testing.T) {
+	if got, want := markdownCell("a|b*c_d\ne"), `a\|b\*c\_d e`; got != want {
+		t.Errorf("markdownCell = %q, want %q", got, want)
+	}
+}
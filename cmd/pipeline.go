@@ -0,0 +1,83 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import "sync"
+
+// defaultConcurrency is the number of concurrent requests used when the
+// concurrency setting is not configured.
+const defaultConcurrency = 4
+
+// workerPool bounds the number of tasks talking to GitHub at the same time.
+// A nil workerPool does not bound anything.
+type workerPool struct {
+	slots chan struct{}
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{slots: make(chan struct{}, size)}
+}
+
+func (p *workerPool) run(task func() error) error {
+	if p == nil {
+		return task()
+	}
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+	return task()
+}
+
+// taskGroup runs tasks concurrently on a workerPool and keeps the first error.
+//
+// Tasks must not wait on other tasks of the same pool, or they could hold
+// every slot while waiting. Code that fans out and waits runs outside the
+// pool (newTaskGroup(nil)) and only the requests themselves run inside it.
+type taskGroup struct {
+	pool *workerPool
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+func newTaskGroup(pool *workerPool) *taskGroup {
+	return &taskGroup{pool: pool}
+}
+
+// Go runs task in a new goroutine. It is safe to call from a running task.
+func (g *taskGroup) Go(task func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := g.pool.run(task); err != nil {
+			g.once.Do(func() { g.err = err })
+		}
+	}()
+}
+
+// Wait waits for every task and returns the first error.
+func (g *taskGroup) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
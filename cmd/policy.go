@@ -0,0 +1,480 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy severities, from the most to the least severe.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+var severityRank = map[string]int{severityError: 3, severityWarning: 2, severityInfo: 1}
+
+// policyCmd represents the policy command
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Evaluate access policies against the access configuration",
+}
+
+// policyCheckCmd represents the policy check command
+var policyCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report the entries of the access configuration that violate the policy rules",
+	Long: `Report the entries of the access configuration that violate the policy rules.
+
+Rules are read from a YAML policy file. Each rule iterates over a resource of
+the access configuration (members, teams, repositories, teamPermissions,
+userPermissions or webhooks) and evaluates expressions
+(https://expr-lang.org) on each entry:
+
+  rules:
+    - name: no-direct-admin
+      description: No user holds ADMIN directly on a repository
+      resource: userPermissions
+      assert: access != "ADMIN"
+    - name: repository-maintained-by-team
+      severity: warning
+      resource: repositories
+      assert: any(config.permissions.teams, .repo == name && atLeast(.access, "MAINTAIN"))
+    - name: outside-collaborators-read-only
+      resource: userPermissions
+      where: isOutsideCollaborator(login)
+      assert: access == "READ"
+    - name: few-owners
+      resource: members
+      where: role == "ADMIN"
+      max: 5
+
+where selects the entries a rule applies to, assert must hold for each of
+them, and min/max bound how many entries are selected. In expressions, the
+fields of the entry are variables named as in the access configuration file,
+item is the entry itself and config is the whole access configuration.
+atLeast(access, level), isMember(login) and isOutsideCollaborator(login) are
+also available.
+
+The command exits with status 1 when a violation reaches --fail-on.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("output")
+		failOn, _ := cmd.Flags().GetString("fail-on")
+		if _, ok := severityRank[failOn]; !ok {
+			log.Fatalf("Invalid --fail-on %q: use error, warning or info", failOn)
+		}
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		policy, err := LoadPolicy(viper.GetString("policy-path"))
+		if err != nil {
+			log.Fatalf("Failed to load policy: %v", err)
+		}
+
+		violations, err := policy.Check(config)
+		if err != nil {
+			log.Fatalf("Failed to evaluate policy: %v", err)
+		}
+
+		if format == "json" {
+			data, err := json.MarshalIndent(violations, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(data))
+		} else {
+			for _, violation := range violations {
+				fmt.Println(violation.Describe())
+			}
+			if len(violations) == 0 {
+				fmt.Println("No policy violations found")
+			}
+		}
+
+		for _, violation := range violations {
+			if severityRank[violation.Severity] >= severityRank[failOn] {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(policyCheckCmd)
+
+	policyCheckCmd.Flags().String("policy", "policy.yaml", "Path to the policy file")
+	viper.BindPFlag("policy-path", policyCheckCmd.Flags().Lookup("policy"))
+	policyCheckCmd.Flags().String("output", "text", "Output format: text or json")
+	policyCheckCmd.Flags().String("fail-on", severityError, "Lowest severity that makes the command fail: error, warning or info")
+}
+
+// Policy is a set of rules on an access configuration.
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule is a rule evaluated on every entry of a resource of the access
+// configuration.
+type PolicyRule struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Severity    string `yaml:"severity,omitempty"`
+	Resource    string `yaml:"resource"`
+	// Where selects the entries the rule applies to. All of them when empty.
+	Where string `yaml:"where,omitempty"`
+	// Assert must be true for every selected entry.
+	Assert string `yaml:"assert,omitempty"`
+	// Min and Max bound the number of selected entries.
+	Min *int `yaml:"min,omitempty"`
+	Max *int `yaml:"max,omitempty"`
+}
+
+// PolicyViolation is an entry that breaks a rule. Entry is nil when the rule
+// is broken by the number of entries rather than by one of them.
+type PolicyViolation struct {
+	Rule     string      `json:"rule"`
+	Severity string      `json:"severity"`
+	Message  string      `json:"message"`
+	Resource string      `json:"resource"`
+	Entry    interface{} `json:"entry,omitempty"`
+}
+
+// Describe returns a one line description of the violation.
+func (v PolicyViolation) Describe() string {
+	line := fmt.Sprintf("%-7s %s: %s", v.Severity, v.Rule, v.Message)
+	if v.Entry != nil {
+		line += fmt.Sprintf(" (%s)", describeEntry(v.Entry))
+	}
+	return line
+}
+
+func describeEntry(entry interface{}) string {
+	switch e := entry.(type) {
+	case UserPermission:
+		return fmt.Sprintf("user permission login=%s repo=%s access=%s", e.Login, e.Repo, e.Access)
+	case TeamPermission:
+		return fmt.Sprintf("team permission slug=%s repo=%s access=%s", e.Slug, e.Repo, e.Access)
+	case MemberInfo:
+		return fmt.Sprintf("member login=%s role=%s", e.Login, e.Role)
+	case TeamInfo:
+		return fmt.Sprintf("team slug=%s", e.Slug)
+	case RepositoryInfo:
+		return fmt.Sprintf("repository name=%s", e.Name)
+	case WebhookInfo:
+		if e.Repo != "" {
+			return fmt.Sprintf("webhook repo=%s host=%s", e.Repo, e.Host)
+		}
+		return fmt.Sprintf("webhook host=%s", e.Host)
+	default:
+		return fmt.Sprint(entry)
+	}
+}
+
+// LoadPolicy loads a policy from a YAML file.
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// policyEntries returns the entries of resource in config.
+func policyEntries(config *AccessConfig, resource string) ([]interface{}, error) {
+	var entries []interface{}
+	switch resource {
+	case "members":
+		for _, member := range config.Members {
+			entries = append(entries, member)
+		}
+	case "teams":
+		for _, team := range config.Teams {
+			entries = append(entries, team)
+		}
+	case "repositories":
+		for _, repo := range config.Repositories {
+			entries = append(entries, repo)
+		}
+	case "teamPermissions":
+		for _, permission := range config.Permissions.Teams {
+			entries = append(entries, permission)
+		}
+	case "userPermissions":
+		for _, permission := range config.Permissions.Users {
+			entries = append(entries, permission)
+		}
+	case "webhooks":
+		for _, hook := range config.Webhooks.Organization {
+			entries = append(entries, hook)
+		}
+		for _, hook := range config.Webhooks.Repositories {
+			entries = append(entries, hook)
+		}
+	default:
+		return nil, fmt.Errorf("unknown resource %q", resource)
+	}
+	return entries, nil
+}
+
+// toPolicyValue converts v to maps and slices keyed as in the access
+// configuration file, which is how rules refer to fields.
+func toPolicyValue(v interface{}) (interface{}, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// policyEnv is the environment of the expressions of a rule.
+type policyEnv struct {
+	config  interface{}
+	members map[string]bool
+}
+
+func newPolicyEnv(config *AccessConfig) (*policyEnv, error) {
+	value, err := toPolicyValue(config)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool)
+	for _, member := range config.Members {
+		members[strings.ToLower(member.Login)] = true
+	}
+	return &policyEnv{config: value, members: members}, nil
+}
+
+// variables returns the variables of the expressions evaluated on entry.
+func (e *policyEnv) variables(entry interface{}) (map[string]interface{}, error) {
+	item, err := toPolicyValue(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]interface{}{
+		"item":   item,
+		"config": e.config,
+		"atLeast": func(access string, level string) bool {
+			return permissionRank(access) >= permissionRank(level)
+		},
+		"isMember": func(login string) bool {
+			return e.members[strings.ToLower(login)]
+		},
+		"isOutsideCollaborator": func(login string) bool {
+			return !e.members[strings.ToLower(login)]
+		},
+	}
+	if fields, ok := item.(map[string]interface{}); ok {
+		for key, value := range fields {
+			if _, reserved := vars[key]; !reserved {
+				vars[key] = value
+			}
+		}
+	}
+	for _, field := range policyEntryFields {
+		if _, ok := vars[field]; !ok {
+			vars[field] = nil
+		}
+	}
+	return vars, nil
+}
+
+// policyEntryFields are the fields of the entries of each resource, which are
+// declared as variables even when an entry omits them.
+var policyEntryFields = []string{
+	"login", "role", "name", "slug", "description", "members", "maintainers", "childTeam", "idpManaged", "idpGroups",
+	"url", "repo", "access", "host", "events", "active", "contentType", "sslVerify",
+}
+
+// compiledRule is a rule with its expressions compiled.
+type compiledRule struct {
+	PolicyRule
+	where  *vm.Program
+	assert *vm.Program
+}
+
+func compileRule(rule PolicyRule) (*compiledRule, error) {
+	compiled := &compiledRule{PolicyRule: rule}
+	if compiled.Severity == "" {
+		compiled.Severity = severityError
+	}
+	if _, ok := severityRank[compiled.Severity]; !ok {
+		return nil, fmt.Errorf("invalid severity %q", compiled.Severity)
+	}
+	if rule.Assert == "" && rule.Min == nil && rule.Max == nil {
+		return nil, fmt.Errorf("the rule needs assert, min or max")
+	}
+
+	// Every variable is declared so that typos fail here rather than
+	// silently evaluating to nil.
+	env := map[string]interface{}{
+		"item":                  nil,
+		"config":                map[string]interface{}{},
+		"atLeast":               func(string, string) bool { return false },
+		"isMember":              func(string) bool { return false },
+		"isOutsideCollaborator": func(string) bool { return false },
+	}
+	for _, field := range policyEntryFields {
+		env[field] = nil
+	}
+
+	var err error
+	if rule.Where != "" {
+		if compiled.where, err = expr.Compile(rule.Where, expr.Env(env), expr.AsBool()); err != nil {
+			return nil, fmt.Errorf("where: %w", err)
+		}
+	}
+	if rule.Assert != "" {
+		if compiled.assert, err = expr.Compile(rule.Assert, expr.Env(env), expr.AsBool()); err != nil {
+			return nil, fmt.Errorf("assert: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+// Check evaluates the rules of the policy on config and returns the
+// violations, in the order of the rules and of the entries.
+func (p *Policy) Check(config *AccessConfig) ([]PolicyViolation, error) {
+	var rules []*compiledRule
+	for _, rule := range p.Rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		rules = append(rules, compiled)
+	}
+
+	env, err := newPolicyEnv(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []PolicyViolation
+	for _, rule := range rules {
+		ruleViolations, err := rule.check(config, env)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		violations = append(violations, ruleViolations...)
+	}
+	return violations, nil
+}
+
+func (r *compiledRule) check(config *AccessConfig, env *policyEnv) ([]PolicyViolation, error) {
+	entries, err := policyEntries(config, r.Resource)
+	if err != nil {
+		return nil, err
+	}
+
+	message := r.Description
+	if message == "" {
+		message = r.Assert
+	}
+
+	var violations []PolicyViolation
+	var selected []interface{}
+	for _, entry := range entries {
+		vars, err := env.variables(entry)
+		if err != nil {
+			return nil, err
+		}
+		if r.where != nil {
+			matched, err := expr.Run(r.where, vars)
+			if err != nil {
+				return nil, fmt.Errorf("where on %s: %w", describeEntry(entry), err)
+			}
+			if !matched.(bool) {
+				continue
+			}
+		}
+		selected = append(selected, entry)
+
+		if r.assert != nil {
+			ok, err := expr.Run(r.assert, vars)
+			if err != nil {
+				return nil, fmt.Errorf("assert on %s: %w", describeEntry(entry), err)
+			}
+			if !ok.(bool) {
+				violations = append(violations, PolicyViolation{Rule: r.Name, Severity: r.Severity, Message: message, Resource: r.Resource, Entry: entry})
+			}
+		}
+	}
+
+	countMessage := r.Description
+	if r.Min != nil && len(selected) < *r.Min {
+		if countMessage == "" {
+			countMessage = fmt.Sprintf("%d %s selected, at least %d required", len(selected), r.Resource, *r.Min)
+		}
+		violations = append(violations, PolicyViolation{Rule: r.Name, Severity: r.Severity, Message: countMessage, Resource: r.Resource})
+	}
+	if r.Max != nil && len(selected) > *r.Max {
+		if countMessage == "" {
+			countMessage = fmt.Sprintf("%d %s selected, at most %d allowed", len(selected), r.Resource, *r.Max)
+		}
+		// Every selected entry is reported, as any of them can be the one to remove.
+		for _, entry := range selected {
+			violations = append(violations, PolicyViolation{Rule: r.Name, Severity: r.Severity, Message: countMessage, Resource: r.Resource, Entry: entry})
+		}
+	}
+	return violations, nil
+}
+
+// permissionRank orders repository permissions from the lowest to the highest.
+// Unknown permissions rank below READ.
+func permissionRank(access string) int {
+	switch strings.ToUpper(access) {
+	case "READ":
+		return 1
+	case "TRIAGE":
+		return 2
+	case "WRITE":
+		return 3
+	case "MAINTAIN":
+		return 4
+	case "ADMIN":
+		return 5
+	default:
+		return 0
+	}
+}
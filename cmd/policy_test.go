@@ -0,0 +1,93 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	policy, err := LoadPolicy("testdata/policy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := policy.Check(config)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	var got []string
+	for _, violation := range violations {
+		got = append(got, violation.Severity+" "+violation.Rule+" "+describeEntry(violation.Entry))
+	}
+	want := []string{
+		"error no-direct-admin user permission login=alice repo=api access=ADMIN",
+		"error no-direct-admin user permission login=erin repo=infra access=ADMIN",
+		"error no-direct-admin user permission login=mallory repo=tools access=ADMIN",
+		"warning repository-maintained-by-team repository name=web",
+		"warning repository-maintained-by-team repository name=docs",
+		"warning repository-maintained-by-team repository name=tools",
+		"error outside-collaborators-read-only user permission login=mallory repo=tools access=ADMIN",
+		"info few-owners member login=alice role=ADMIN",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPolicyCheckMinCount(t *testing.T) {
+	min := 2
+	policy := &Policy{Rules: []PolicyRule{{Name: "two-security-managers", Resource: "teams", Where: `slug in config.securityManagers`, Min: &min}}}
+
+	violations, err := policy.Check(loadFixture(t, "acme.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || violations[0].Entry != nil || !strings.Contains(violations[0].Message, "1 teams selected") {
+		t.Errorf("violations = %+v, want one count violation", violations)
+	}
+}
+
+func TestPolicyCheckInvalidRules(t *testing.T) {
+	tests := []struct {
+		rule    PolicyRule
+		wantErr string
+	}{
+		{PolicyRule{Name: "typo", Resource: "members", Assert: `rol == "ADMIN"`}, "unknown name rol"},
+		{PolicyRule{Name: "not-bool", Resource: "members", Assert: `login`}, "assert"},
+		{PolicyRule{Name: "resource", Resource: "users", Assert: `true`}, "unknown resource"},
+		{PolicyRule{Name: "severity", Resource: "members", Severity: "fatal", Assert: `true`}, "severity"},
+		{PolicyRule{Name: "empty", Resource: "members"}, "assert, min or max"},
+	}
+
+	for _, tt := range tests {
+		policy := &Policy{Rules: []PolicyRule{tt.rule}}
+		_, err := policy.Check(loadFixture(t, "acme.yaml"))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), tt.rule.Name) {
+			t.Errorf("rule %s: error = %v, want %q", tt.rule.Name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// secretProfileKeys are never printed by profile show.
+var secretProfileKeys = map[string]bool{"token": true}
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage the connection profiles of the config file",
+	Long: `Manage the connection profiles of the config file.
+
+A profile groups the settings of one GitHub instance:
+
+  profile: ghes
+  profiles:
+    github:
+      organizations: [acme, acme-labs]
+    ghes:
+      endpoint: https://github.acme.example
+      ca-bundle: /etc/ssl/acme-ca.pem
+      credential-command: pass show ghes/token
+      organization: platform
+      aac-path: ghes/access-config.json
+      aac-format: json
+
+The profile in use is the --profile flag, otherwise the profile key. Its
+settings take precedence over the rest of the config file, and flags and
+environment variables take precedence over the profile.`,
+}
+
+// profileListCmd represents the profile list command
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the profiles, marking the one in use",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, name := range profileNames(viper.GetViper()) {
+			marker := " "
+			if name == viper.GetString("profile") {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+	},
+}
+
+// profileUseCmd represents the profile use command
+var profileUseCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Set the profile used by default",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		if !viper.IsSet("profiles." + name) {
+			log.Fatalf("Unknown profile %q", name)
+		}
+		path := viper.ConfigFileUsed()
+		if path == "" {
+			log.Fatal("No config file found: create $HOME/.gh-aac.yaml with the profiles first")
+		}
+		if err := setDefaultProfile(path, name); err != nil {
+			log.Fatalf("Failed to update %s: %v", path, err)
+		}
+		fmt.Printf("Using profile %s\n", name)
+	},
+}
+
+// profileShowCmd represents the profile show command
+var profileShowCmd = &cobra.Command{
+	Use:   "show [profile]",
+	Short: "Print the settings of a profile, the one in use by default",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := viper.GetString("profile")
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if name == "" {
+			log.Fatal("No profile in use: pass the name of a profile")
+		}
+
+		profile := viper.Sub("profiles." + name)
+		if profile == nil {
+			log.Fatalf("Unknown profile %q", name)
+		}
+		settings := profile.AllSettings()
+		for key := range settings {
+			if secretProfileKeys[key] {
+				settings[key] = "********"
+			}
+		}
+
+		data, err := yaml.Marshal(map[string]interface{}{name: settings})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(string(data))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd, profileUseCmd, profileShowCmd)
+}
+
+// profileNames returns the sorted names of the profiles of v.
+func profileNames(v *viper.Viper) []string {
+	var names []string
+	for name := range v.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile merges the settings of profile name over the config file of v,
+// so that flags and environment variables still take precedence.
+func applyProfile(v *viper.Viper, name string) error {
+	if name == "" {
+		return nil
+	}
+	profile := v.Sub("profiles." + name)
+	if profile == nil {
+		return fmt.Errorf("unknown profile %q, the config file has %v", name, profileNames(v))
+	}
+
+	settings := profile.AllSettings()
+	// A profile listing organizations replaces a single organization of the
+	// config file, which would otherwise win.
+	if _, ok := settings["organizations"]; ok {
+		if _, ok := settings["organization"]; !ok {
+			settings["organization"] = ""
+		}
+	}
+	return v.MergeConfigMap(settings)
+}
+
+// setDefaultProfile sets the profile key of the config file at path, keeping
+// the rest of the file, comments included, as it is.
+func setDefaultProfile(path string, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("the config file is not a YAML mapping")
+	}
+	root := doc.Content[0]
+
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}
+	found := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "profile" {
+			root.Content[i+1] = value
+			found = true
+			break
+		}
+	}
+	if !found {
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "profile"}
+		root.Content = append([]*yaml.Node{key, value}, root.Content...)
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0600)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const profilesConfig = `# Shared settings
+organization: acme
+aac-format: yaml
+profiles:
+  github:
+    organizations: [acme, acme-labs]
+  ghes:
+    endpoint: https://github.acme.example
+    token: secret
+    organization: platform
+    aac-format: json
+`
+
+func writeProfilesConfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".gh-aac.yaml")
+	if err := os.WriteFile(path, []byte(profilesConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readProfilesConfig(t *testing.T, path string) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestApplyProfile(t *testing.T) {
+	path := writeProfilesConfig(t)
+
+	v := readProfilesConfig(t, path)
+	if err := applyProfile(v, "ghes"); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.GetString("endpoint"); got != "https://github.acme.example" {
+		t.Errorf("endpoint = %q", got)
+	}
+	if got := v.GetString("organization"); got != "platform" {
+		t.Errorf("organization = %q", got)
+	}
+	if got := v.GetString("aac-format"); got != "json" {
+		t.Errorf("aac-format = %q", got)
+	}
+
+	v = readProfilesConfig(t, path)
+	if err := applyProfile(v, "github"); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.GetString("organization"); got != "" {
+		t.Errorf("the organization of the config file was kept: %q", got)
+	}
+	if got := v.GetStringSlice("organizations"); !reflect.DeepEqual(got, []string{"acme", "acme-labs"}) {
+		t.Errorf("organizations = %v", got)
+	}
+
+	v = readProfilesConfig(t, path)
+	if err := applyProfile(v, "missing"); err == nil || !strings.Contains(err.Error(), "ghes") {
+		t.Errorf("error = %v, want the list of profiles", err)
+	}
+}
+
+func TestApplyProfileKeepsFlagPrecedence(t *testing.T) {
+	v := readProfilesConfig(t, writeProfilesConfig(t))
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("endpoint", "", "")
+	v.BindPFlag("endpoint", flags.Lookup("endpoint"))
+	if err := flags.Parse([]string{"--endpoint", "https://github.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyProfile(v, "ghes"); err != nil {
+		t.Fatal(err)
+	}
+	if got := v.GetString("endpoint"); got != "https://github.com" {
+		t.Errorf("endpoint = %q, want the flag value", got)
+	}
+}
+
+func TestSetDefaultProfile(t *testing.T) {
+	path := writeProfilesConfig(t)
+
+	for _, name := range []string{"ghes", "github"} {
+		if err := setDefaultProfile(path, name); err != nil {
+			t.Fatal(err)
+		}
+		if got := readProfilesConfig(t, path).GetString("profile"); got != name {
+			t.Errorf("profile = %q, want %q", got, name)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# Shared settings") {
+		t.Errorf("the comments of the config file were lost:\n%s", data)
+	}
+	if strings.Count(string(data), "profile:") != 1 {
+		t.Errorf("the profile key is duplicated:\n%s", data)
+	}
+}
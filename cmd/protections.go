@@ -0,0 +1,214 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// getRepoEnvironments returns the deployment environments of a repository
+// that require reviewers, with their reviewers.
+func getRepoEnvironments(ctx context.Context, client *http.Client, organization string, repo string) ([]EnvironmentInfo, error) {
+	var environments []EnvironmentInfo
+
+	next := fmt.Sprintf("repos/%s/%s/environments?per_page=100", organization, repo)
+	for next != "" {
+		var page struct {
+			Environments []struct {
+				Name            string `json:"name"`
+				ProtectionRules []struct {
+					Type      string `json:"type"`
+					Reviewers []struct {
+						Type     string `json:"type"`
+						Reviewer struct {
+							Login string `json:"login"`
+							Slug  string `json:"slug"`
+						} `json:"reviewer"`
+					} `json:"reviewers"`
+				} `json:"protection_rules"`
+			} `json:"environments"`
+		}
+		var err error
+		next, err = restRequest(ctx, client, http.MethodGet, next, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, environment := range page.Environments {
+			info := EnvironmentInfo{Repo: repo, Name: environment.Name}
+			for _, rule := range environment.ProtectionRules {
+				if rule.Type != "required_reviewers" {
+					continue
+				}
+				for _, reviewer := range rule.Reviewers {
+					if reviewer.Type == "Team" {
+						info.Teams = append(info.Teams, reviewer.Reviewer.Slug)
+					} else {
+						info.Users = append(info.Users, reviewer.Reviewer.Login)
+					}
+				}
+			}
+			if len(info.Users) > 0 || len(info.Teams) > 0 {
+				environments = append(environments, info)
+			}
+		}
+	}
+
+	return environments, nil
+}
+
+// bypassAllowance is an actor allowed to bypass a branch protection rule.
+type bypassAllowance struct {
+	Actor struct {
+		User struct {
+			Login githubv4.String
+		} `graphql:"... on User"`
+		Team struct {
+			Slug githubv4.String
+		} `graphql:"... on Team"`
+	}
+}
+
+type BranchProtectionQuery struct {
+	RateLimit  RateLimitInfo
+	Repository struct {
+		BranchProtectionRules struct {
+			Nodes []struct {
+				Pattern                     githubv4.String
+				BypassPullRequestAllowances struct {
+					Nodes []bypassAllowance
+				} `graphql:"bypassPullRequestAllowances(first: 100)"`
+				BypassForcePushAllowances struct {
+					Nodes []bypassAllowance
+				} `graphql:"bypassForcePushAllowances(first: 100)"`
+			}
+			PageInfo struct {
+				EndCursor   githubv4.String
+				HasNextPage bool
+			}
+		} `graphql:"branchProtectionRules(first: 50, after: $afterCursor)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+}
+
+// getBranchProtections returns the branch protection rules of a repository
+// that someone can bypass. Apps allowed to bypass a rule are left out.
+func getBranchProtections(ctx context.Context, client *githubv4.Client, organization string, repo string) ([]BranchProtectionInfo, error) {
+	var protections []BranchProtectionInfo
+	var afterCursor *githubv4.String
+
+	for {
+		var query BranchProtectionQuery
+		variables := map[string]interface{}{
+			"org":         githubv4.String(organization),
+			"repo":        githubv4.String(repo),
+			"afterCursor": afterCursor,
+		}
+		if err := client.Query(ctx, &query, variables); err != nil {
+			return nil, fmt.Errorf("error ejecutando la consulta: %w", err)
+		}
+
+		for _, rule := range query.Repository.BranchProtectionRules.Nodes {
+			info := BranchProtectionInfo{Repo: repo, Pattern: string(rule.Pattern)}
+			allowances := append(rule.BypassPullRequestAllowances.Nodes, rule.BypassForcePushAllowances.Nodes...)
+			for _, allowance := range allowances {
+				if login := string(allowance.Actor.User.Login); login != "" && !containsFold(info.BypassUsers, login) {
+					info.BypassUsers = append(info.BypassUsers, login)
+				}
+				if slug := string(allowance.Actor.Team.Slug); slug != "" && !containsFold(info.BypassTeams, slug) {
+					info.BypassTeams = append(info.BypassTeams, slug)
+				}
+			}
+			if len(info.BypassUsers) > 0 || len(info.BypassTeams) > 0 {
+				protections = append(protections, info)
+			}
+		}
+
+		if !query.Repository.BranchProtectionRules.PageInfo.HasNextPage {
+			break
+		}
+		afterCursor = &query.Repository.BranchProtectionRules.PageInfo.EndCursor
+	}
+
+	return protections, nil
+}
+
+// isGraphQLForbidden reports whether err is a GraphQL error for a resource
+// the token is not allowed to read.
+func isGraphQLForbidden(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "Resource not accessible") || strings.Contains(message, "Must have admin rights") ||
+		strings.Contains(message, "has not been granted the required scopes")
+}
+
+// getProtections fetches the environment reviewers and the branch protection
+// bypasses of every repository, concurrently on pool. Repositories the token
+// cannot read them from are skipped.
+func getProtections(ctx context.Context, pool *workerPool, provider Provider, organization string, repos []RepositoryInfo) ([]EnvironmentInfo, []BranchProtectionInfo, error) {
+	repoEnvironments := make([][]EnvironmentInfo, len(repos))
+	repoProtections := make([][]BranchProtectionInfo, len(repos))
+
+	g := newTaskGroup(pool)
+	for i, repo := range repos {
+		i, repo := i, repo
+		g.Go(func() error {
+			environments, err := provider.RepoEnvironments(ctx, organization, repo.Name)
+			if err != nil {
+				if !skipUnavailable(err, "the repo scope") {
+					return err
+				}
+				log.Printf("Skipping environments for %s/%s: %v\n", organization, repo.Name, err)
+				return nil
+			}
+			repoEnvironments[i] = environments
+			return nil
+		})
+		g.Go(func() error {
+			protections, err := provider.BranchProtections(ctx, organization, repo.Name)
+			if err != nil {
+				if !isGraphQLForbidden(err) {
+					return err
+				}
+				log.Printf("Skipping branch protections for %s/%s: %v\n", organization, repo.Name, err)
+				return nil
+			}
+			repoProtections[i] = protections
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	var environments []EnvironmentInfo
+	var protections []BranchProtectionInfo
+	for i := range repos {
+		environments = append(environments, repoEnvironments[i]...)
+		protections = append(protections, repoProtections[i]...)
+	}
+	return environments, protections, nil
+}
@@ -0,0 +1,221 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// Provider gives access to the GitHub data of organizations. Commands only
+// talk to GitHub through a Provider, so they can run against a fake in tests.
+type Provider interface {
+	OrganizationInfo(ctx context.Context, organization string) (OrganizationInfo, error)
+	Repos(ctx context.Context, organization string) ([]RepositoryInfo, error)
+	Teams(ctx context.Context, organization string) ([]TeamInfo, error)
+	Members(ctx context.Context, organization string) ([]MemberInfo, error)
+	DefaultRepositoryPermission(ctx context.Context, organization string) (string, error)
+	TeamPermissions(ctx context.Context, organization string, slug string) ([]TeamPermission, error)
+	// CollaboratorsPage returns the first page of collaborators of a page of
+	// repositories, starting after repoCursor.
+	CollaboratorsPage(ctx context.Context, organization string, repoCursor *string) (CollaboratorsPage, error)
+	// RepoCollaborators returns the collaborators of a repository after
+	// collabCursor, or from the start when collabCursor is nil.
+	RepoCollaborators(ctx context.Context, organization string, repo string, collabCursor *string) ([]UserPermission, error)
+	ExternalIdentities(ctx context.Context, organization string) ([]IdentityInfo, error)
+	OrganizationWebhooks(ctx context.Context, organization string) ([]WebhookInfo, error)
+	RepoWebhooks(ctx context.Context, organization string, repo string) ([]WebhookInfo, error)
+	RepoEnvironments(ctx context.Context, organization string, repo string) ([]EnvironmentInfo, error)
+	BranchProtections(ctx context.Context, organization string, repo string) ([]BranchProtectionInfo, error)
+	SecurityManagers(ctx context.Context, organization string) (RoleList, error)
+	Moderators(ctx context.Context, organization string) (ModeratorsInfo, error)
+	TeamSyncEnabled(ctx context.Context, organization string) (bool, error)
+	TeamSyncMapping(ctx context.Context, organization string, slug string) ([]IdPGroupInfo, error)
+	IdPGroups(ctx context.Context, organization string) ([]IdPGroupInfo, error)
+	AuditLog(ctx context.Context, organization string, from time.Time, to time.Time) ([]AuditEvent, error)
+	RepoActivity(ctx context.Context, organization string, repo string, since time.Time) ([]RepoActivity, error)
+	MemberActivity(ctx context.Context, organization string, since time.Time) ([]MemberActivity, error)
+
+	AddSecurityManager(ctx context.Context, organization string, team string) error
+	RemoveSecurityManager(ctx context.Context, organization string, team string) error
+	// SetModerator grants (or revokes, when grant is false) the moderator
+	// role to a user or a team.
+	SetModerator(ctx context.Context, organization string, user string, team string, grant bool) error
+	SetTeamSyncMapping(ctx context.Context, organization string, slug string, groups []IdPGroupInfo) error
+}
+
+// CollaboratorsPage is a page of repositories with their first collaborators.
+type CollaboratorsPage struct {
+	Repos []RepoCollaborators
+	// EndCursor is nil on the last page.
+	EndCursor *string
+}
+
+// RepoCollaborators are the first collaborators of a repository.
+type RepoCollaborators struct {
+	Repo        string
+	Permissions []UserPermission
+	// NextCursor is set when the repository has more collaborators.
+	NextCursor *string
+}
+
+// githubProvider is the Provider backed by the GitHub GraphQL and REST APIs.
+type githubProvider struct {
+	client     *githubv4.Client
+	httpClient *http.Client
+}
+
+// newGitHubProvider returns a Provider for the configured endpoint,
+// authenticated for organization.
+func newGitHubProvider(ctx context.Context, organization string) (Provider, error) {
+	httpClient := newHTTPClient(ctx, organization)
+	if err := verifyEndpoint(ctx, httpClient); err != nil {
+		return nil, err
+	}
+	return &githubProvider{
+		client:     githubv4.NewEnterpriseClient(URLGRAPHQL, httpClient),
+		httpClient: httpClient,
+	}, nil
+}
+
+// mustGitHubProvider returns the Provider of newGitHubProvider, exiting on
+// error. Commands acting on a single organization use it.
+func mustGitHubProvider(ctx context.Context, organization string) Provider {
+	provider, err := newGitHubProvider(ctx, organization)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return provider
+}
+
+func (p *githubProvider) OrganizationInfo(ctx context.Context, organization string) (OrganizationInfo, error) {
+	return getOrganizationInfo(ctx, p.client, organization)
+}
+
+func (p *githubProvider) Repos(ctx context.Context, organization string) ([]RepositoryInfo, error) {
+	return getRepos(ctx, p.client, organization)
+}
+
+func (p *githubProvider) Teams(ctx context.Context, organization string) ([]TeamInfo, error) {
+	return getTeams(ctx, p.client, organization)
+}
+
+func (p *githubProvider) Members(ctx context.Context, organization string) ([]MemberInfo, error) {
+	return getMembers(ctx, p.client, organization)
+}
+
+func (p *githubProvider) DefaultRepositoryPermission(ctx context.Context, organization string) (string, error) {
+	return getDefaultRepositoryPermission(ctx, p.httpClient, organization)
+}
+
+func (p *githubProvider) TeamPermissions(ctx context.Context, organization string, slug string) ([]TeamPermission, error) {
+	return getTeamPermissions(ctx, p.client, organization, slug)
+}
+
+func (p *githubProvider) CollaboratorsPage(ctx context.Context, organization string, repoCursor *string) (CollaboratorsPage, error) {
+	return getCollaboratorsPage(ctx, p.client, organization, repoCursor)
+}
+
+func (p *githubProvider) RepoCollaborators(ctx context.Context, organization string, repo string, collabCursor *string) ([]UserPermission, error) {
+	var cursor *githubv4.String
+	if collabCursor != nil {
+		cursor = githubv4.NewString(githubv4.String(*collabCursor))
+	}
+	return getRepoCollaborators(ctx, p.client, organization, repo, cursor)
+}
+
+func (p *githubProvider) ExternalIdentities(ctx context.Context, organization string) ([]IdentityInfo, error) {
+	return getExternalIdentities(ctx, p.client, organization)
+}
+
+func (p *githubProvider) OrganizationWebhooks(ctx context.Context, organization string) ([]WebhookInfo, error) {
+	return getRESTWebhooks(ctx, p.httpClient, fmt.Sprintf("orgs/%s/hooks", organization), "")
+}
+
+func (p *githubProvider) RepoWebhooks(ctx context.Context, organization string, repo string) ([]WebhookInfo, error) {
+	return getRESTWebhooks(ctx, p.httpClient, fmt.Sprintf("repos/%s/%s/hooks", organization, repo), repo)
+}
+
+func (p *githubProvider) RepoEnvironments(ctx context.Context, organization string, repo string) ([]EnvironmentInfo, error) {
+	return getRepoEnvironments(ctx, p.httpClient, organization, repo)
+}
+
+func (p *githubProvider) BranchProtections(ctx context.Context, organization string, repo string) ([]BranchProtectionInfo, error) {
+	return getBranchProtections(ctx, p.client, organization, repo)
+}
+
+func (p *githubProvider) SecurityManagers(ctx context.Context, organization string) (RoleList, error) {
+	return getSecurityManagers(ctx, p.httpClient, organization)
+}
+
+func (p *githubProvider) Moderators(ctx context.Context, organization string) (ModeratorsInfo, error) {
+	return getModerators(ctx, p.httpClient, organization)
+}
+
+func (p *githubProvider) TeamSyncEnabled(ctx context.Context, organization string) (bool, error) {
+	return isTeamSyncEnabled(ctx, p.httpClient, organization)
+}
+
+func (p *githubProvider) TeamSyncMapping(ctx context.Context, organization string, slug string) ([]IdPGroupInfo, error) {
+	return getTeamSyncMapping(ctx, p.httpClient, organization, slug)
+}
+
+func (p *githubProvider) IdPGroups(ctx context.Context, organization string) ([]IdPGroupInfo, error) {
+	return getIdPGroups(ctx, p.httpClient, organization)
+}
+
+func (p *githubProvider) AuditLog(ctx context.Context, organization string, from time.Time, to time.Time) ([]AuditEvent, error) {
+	return getAuditLog(ctx, p.httpClient, organization, from, to)
+}
+
+func (p *githubProvider) RepoActivity(ctx context.Context, organization string, repo string, since time.Time) ([]RepoActivity, error) {
+	return getRepoActivity(ctx, p.httpClient, organization, repo, since)
+}
+
+func (p *githubProvider) MemberActivity(ctx context.Context, organization string, since time.Time) ([]MemberActivity, error) {
+	return getMemberActivity(ctx, p.client, p.httpClient, organization, since)
+}
+
+func (p *githubProvider) AddSecurityManager(ctx context.Context, organization string, team string) error {
+	return addSecurityManager(ctx, p.httpClient, organization, team)
+}
+
+func (p *githubProvider) RemoveSecurityManager(ctx context.Context, organization string, team string) error {
+	return removeSecurityManager(ctx, p.httpClient, organization, team)
+}
+
+func (p *githubProvider) SetModerator(ctx context.Context, organization string, user string, team string, grant bool) error {
+	method := http.MethodPut
+	if !grant {
+		method = http.MethodDelete
+	}
+	return setModerator(ctx, p.httpClient, organization, user, team, method)
+}
+
+func (p *githubProvider) SetTeamSyncMapping(ctx context.Context, organization string, slug string, groups []IdPGroupInfo) error {
+	return setTeamSyncMapping(ctx, p.httpClient, organization, slug, groups)
+}
@@ -0,0 +1,313 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// permissionLevels are the repository permissions, indexed by permissionRank.
+var permissionLevels = []string{"", "READ", "TRIAGE", "WRITE", "MAINTAIN", "ADMIN"}
+
+// recommendCmd represents the recommend command
+var recommendCmd = &cobra.Command{
+	Use:   "recommend",
+	Short: "Recommend least-privilege permissions from the activity on each repository",
+	Long: `Recommend least-privilege permissions from the activity on each repository.
+
+The commits, pull requests, reviews, pushes and other events of every
+repository of the access configuration file are read for the time window
+given by --since. Each user and team permission is then compared with the
+activity of the user, or of the members of the team and its child teams:
+
+  - a permission with no activity at all is removed,
+  - a WRITE, MAINTAIN or ADMIN permission is lowered to the permission the
+    activity needs (WRITE for commits, pushes, merges and releases, READ for
+    pull requests, reviews and comments).
+
+Organization owners are left out, as they keep admin access to every
+repository. The recommendations are printed to stderr and a patch to the
+access configuration file to stdout, to be reviewed in a pull request:
+
+  gh aac recommend --since 90d > least-privilege.patch
+  git apply least-privilege.patch
+
+With --write the file is updated instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sinceFlag, _ := cmd.Flags().GetString("since")
+		write, _ := cmd.Flags().GetBool("write")
+
+		since, err := parseAuditTime(sinceFlag, time.Now())
+		if err != nil {
+			log.Fatalf("Invalid --since: %v", err)
+		}
+
+		path := viper.GetString("aac-path")
+		original, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read config: %v", err)
+		}
+		config, err := LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		organization, err := targetOrganization()
+		if err != nil {
+			if config.Organization.Login == "" {
+				log.Fatal(err)
+			}
+			organization = config.Organization.Login
+		}
+
+		ctx := context.Background()
+		activity, err := getActivity(ctx, mustGitHubProvider(ctx, organization), organization, config, since)
+		if err != nil {
+			log.Fatalf("Failed to get the activity of %s: %v", organization, err)
+		}
+
+		recommendations := recommendPermissions(config, activity, since)
+		if len(recommendations) == 0 {
+			log.Println("Every permission is in use, nothing to recommend")
+			return
+		}
+		for _, recommendation := range recommendations {
+			fmt.Fprintln(os.Stderr, recommendation.Describe())
+		}
+
+		applyRecommendations(config, recommendations)
+		updated, err := marshalConfig(config, configFormat(path))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if write {
+			if err := os.WriteFile(path, updated, 0644); err != nil {
+				log.Fatalf("Failed to write %s: %v", path, err)
+			}
+			log.Printf("Updated %s with %d recommendations", path, len(recommendations))
+			return
+		}
+		fmt.Print(unifiedDiff(path, string(original), string(updated)))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recommendCmd)
+	recommendCmd.Flags().String("since", "90d", "Start of the activity window, as a duration ago (72h, 90d) or a date (2006-01-02)")
+	recommendCmd.Flags().Bool("write", false, "Update the access configuration file instead of printing a patch")
+}
+
+// Recommendation is a change to a permission of the access configuration.
+type Recommendation struct {
+	Repo string
+	// Login is set for user permissions and Team for team permissions.
+	Login string
+	Team  string
+	// Current is the permission in the file and Recommended the proposed
+	// one, empty to remove the permission.
+	Current     string
+	Recommended string
+	Reason      string
+}
+
+// Describe returns a human readable sentence for the recommendation.
+func (r Recommendation) Describe() string {
+	who := "user " + r.Login
+	if r.Team != "" {
+		who = "team " + r.Team
+	}
+	if r.Recommended == "" {
+		return fmt.Sprintf("%s: remove %s %s (%s)", r.Repo, who, r.Current, r.Reason)
+	}
+	return fmt.Sprintf("%s: lower %s from %s to %s (%s)", r.Repo, who, r.Current, r.Recommended, r.Reason)
+}
+
+// getActivity returns the activity on every repository of config since the
+// given time.
+func getActivity(ctx context.Context, provider Provider, organization string, config *AccessConfig, since time.Time) ([]RepoActivity, error) {
+	results := make([][]RepoActivity, len(config.Repositories))
+	group := newTaskGroup(newWorkerPool(viper.GetInt("concurrency")))
+	for i, repo := range config.Repositories {
+		i, repo := i, repo
+		group.Go(func() error {
+			activity, err := provider.RepoActivity(ctx, organization, repo.Name, since)
+			results[i] = activity
+			return err
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	var activity []RepoActivity
+	for _, result := range results {
+		activity = append(activity, result...)
+	}
+	return activity, nil
+}
+
+// activityUsage is the highest permission the activity of a user on a
+// repository needs, with the kind of activity that needs it.
+type activityUsage struct {
+	rank int
+	kind string
+}
+
+// recommendPermissions compares the permissions of config with the activity
+// since the given time and returns the permissions to lower or remove.
+func recommendPermissions(config *AccessConfig, activity []RepoActivity, since time.Time) []Recommendation {
+	// usage[repo][login] is what the activity of login on repo needs.
+	usage := make(map[string]map[string]activityUsage)
+	for _, event := range activity {
+		repo, login := strings.ToLower(event.Repo), strings.ToLower(event.Login)
+		if usage[repo] == nil {
+			usage[repo] = make(map[string]activityUsage)
+		}
+		if rank := permissionRank(activityPermission[event.Kind]); rank > usage[repo][login].rank {
+			usage[repo][login] = activityUsage{rank: rank, kind: event.Kind}
+		}
+	}
+
+	owners := make(map[string]bool)
+	for _, member := range config.Members {
+		if strings.EqualFold(member.Role, "ADMIN") {
+			owners[strings.ToLower(member.Login)] = true
+		}
+	}
+
+	idle := fmt.Sprintf("no activity since %s", since.Format("2006-01-02"))
+	recommend := func(current string, used activityUsage) (string, string, bool) {
+		rank := permissionRank(current)
+		switch {
+		case rank == 0:
+			return "", "", false
+		case used.rank == 0:
+			return "", idle, true
+		case used.rank < rank && rank >= permissionRank("WRITE"):
+			return permissionLevels[used.rank], fmt.Sprintf("%s needs %s", used.kind, permissionLevels[used.rank]), true
+		}
+		return "", "", false
+	}
+
+	var recommendations []Recommendation
+	for _, permission := range config.Permissions.Users {
+		if owners[strings.ToLower(permission.Login)] {
+			continue
+		}
+		used := usage[strings.ToLower(permission.Repo)][strings.ToLower(permission.Login)]
+		if recommended, reason, ok := recommend(permission.Access, used); ok {
+			recommendations = append(recommendations, Recommendation{
+				Repo:        permission.Repo,
+				Login:       permission.Login,
+				Current:     permission.Access,
+				Recommended: recommended,
+				Reason:      reason,
+			})
+		}
+	}
+
+	for _, permission := range config.Permissions.Teams {
+		// A team is as used as its most active member.
+		var used activityUsage
+		for _, login := range teamMembers(config, permission.Slug) {
+			if member := usage[strings.ToLower(permission.Repo)][strings.ToLower(login)]; member.rank > used.rank {
+				used = member
+			}
+		}
+		if recommended, reason, ok := recommend(permission.Access, used); ok {
+			recommendations = append(recommendations, Recommendation{
+				Repo:        permission.Repo,
+				Team:        permission.Slug,
+				Current:     permission.Access,
+				Recommended: recommended,
+				Reason:      reason,
+			})
+		}
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return strings.ToLower(recommendations[i].Repo) < strings.ToLower(recommendations[j].Repo)
+	})
+	return recommendations
+}
+
+// teamMembers returns the members of the team and of its child teams, which
+// inherit its permissions.
+func teamMembers(config *AccessConfig, slug string) []string {
+	var members []string
+	visited := make(map[*TeamInfo]bool)
+	var visit func(slug string)
+	visit = func(slug string) {
+		team := findTeam(config, slug)
+		if team == nil || visited[team] {
+			return
+		}
+		visited[team] = true
+		members = append(members, team.Members...)
+		for _, child := range team.ChildTeams {
+			visit(child)
+		}
+	}
+	visit(slug)
+	return members
+}
+
+// applyRecommendations changes the permissions of config as recommended.
+func applyRecommendations(config *AccessConfig, recommendations []Recommendation) {
+	for _, recommendation := range recommendations {
+		if recommendation.Team != "" {
+			teams := config.Permissions.Teams[:0]
+			for _, permission := range config.Permissions.Teams {
+				if strings.EqualFold(permission.Repo, recommendation.Repo) && sameTeam(config, permission.Slug, recommendation.Team) {
+					if recommendation.Recommended == "" {
+						continue
+					}
+					permission.Access = recommendation.Recommended
+				}
+				teams = append(teams, permission)
+			}
+			config.Permissions.Teams = teams
+			continue
+		}
+
+		users := config.Permissions.Users[:0]
+		for _, permission := range config.Permissions.Users {
+			if strings.EqualFold(permission.Repo, recommendation.Repo) && strings.EqualFold(permission.Login, recommendation.Login) {
+				if recommendation.Recommended == "" {
+					continue
+				}
+				permission.Access = recommendation.Recommended
+			}
+			users = append(users, permission)
+		}
+		config.Permissions.Users = users
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecommendPermissions(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	since := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := since.AddDate(0, 1, 0)
+	activity := []RepoActivity{
+		{Login: "alice", Repo: "tools", Kind: activityComment, At: at},
+		{Login: "bob", Repo: "api", Kind: activityCommit, At: at},
+		{Login: "carol", Repo: "api", Kind: activityReview, At: at},
+		{Login: "Frank", Repo: "api", Kind: activityComment, At: at},
+		{Login: "dave", Repo: "web", Kind: activityPush, At: at},
+		{Login: "erin", Repo: "infra", Kind: activityPullRequest, At: at},
+	}
+
+	idle := "no activity since 2023-01-01"
+	want := []Recommendation{
+		{Repo: "api", Login: "carol", Current: "WRITE", Recommended: "READ", Reason: "review needs READ"},
+		{Repo: "api", Login: "outsider", Current: "READ", Reason: idle},
+		{Repo: "api", Team: "backend", Current: "MAINTAIN", Recommended: "WRITE", Reason: "commit needs WRITE"},
+		{Repo: "infra", Login: "erin", Current: "ADMIN", Recommended: "READ", Reason: "pull_request needs READ"},
+		{Repo: "infra", Team: "platform", Current: "ADMIN", Recommended: "READ", Reason: "pull_request needs READ"},
+		{Repo: "infra", Team: "security", Current: "READ", Reason: idle},
+		{Repo: "tools", Login: "mallory", Current: "ADMIN", Reason: idle},
+		{Repo: "web", Team: "security", Current: "READ", Reason: idle},
+	}
+	if got := recommendPermissions(config, activity, since); !reflect.DeepEqual(got, want) {
+		t.Errorf("recommendations:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestApplyRecommendationsPatch(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	original, err := marshalConfig(config, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applyRecommendations(config, []Recommendation{
+		{Repo: "api", Login: "carol", Current: "WRITE", Recommended: "READ"},
+		{Repo: "tools", Login: "mallory", Current: "ADMIN"},
+		{Repo: "web", Team: "Security", Current: "READ"},
+	})
+	updated, err := marshalConfig(config, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := unifiedDiff("access-config.yaml", string(original), string(updated))
+	for _, want := range []string{
+		"--- a/access-config.yaml\n+++ b/access-config.yaml\n",
+		"-          access: WRITE\n+          access: READ\n           login: carol\n",
+		"-        - repo: tools\n-          access: ADMIN\n-          login: mallory\n",
+		"-        - repo: web\n-          access: READ\n-          slug: security\n",
+	} {
+		if !strings.Contains(patch, want) {
+			t.Errorf("patch does not contain %q:\n%s", want, patch)
+		}
+	}
+	if strings.Count(patch, "\n-") != 7 || strings.Count(patch, "\n+") != 2 {
+		t.Errorf("unexpected changes in patch:\n%s", patch)
+	}
+	if unifiedDiff("access-config.yaml", string(original), string(original)) != "" {
+		t.Error("the patch of an unchanged file is not empty")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldText := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	newText := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	want := `--- a/f
++++ b/f
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`
+	if got := unifiedDiff("f", oldText, newText); got != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGetRepoActivity(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	since := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	f.rest["repos/acme/api/commits"] = []interface{}{
+		map[string]interface{}{"author": map[string]interface{}{"login": "bob"}, "commit": map[string]interface{}{"author": map[string]interface{}{"date": "2023-03-10T00:00:00Z"}}},
+		map[string]interface{}{"author": nil, "commit": map[string]interface{}{"author": map[string]interface{}{"date": "2023-03-11T00:00:00Z"}}},
+	}
+	f.rest["repos/acme/api/pulls"] = []interface{}{
+		map[string]interface{}{"user": map[string]interface{}{"login": "carol"}, "created_at": "2023-03-05T00:00:00Z", "updated_at": "2023-03-20T00:00:00Z"},
+		map[string]interface{}{"user": map[string]interface{}{"login": "dave"}, "created_at": "2023-01-05T00:00:00Z", "updated_at": "2023-03-02T00:00:00Z"},
+		map[string]interface{}{"user": map[string]interface{}{"login": "erin"}, "created_at": "2023-01-01T00:00:00Z", "updated_at": "2023-02-01T00:00:00Z"},
+		map[string]interface{}{"user": map[string]interface{}{"login": "frank"}, "created_at": "2022-12-01T00:00:00Z", "updated_at": "2022-12-01T00:00:00Z"},
+	}
+	f.rest["repos/acme/api/events"] = []interface{}{
+		map[string]interface{}{"type": "PullRequestEvent", "actor": map[string]interface{}{"login": "bob"}, "payload": map[string]interface{}{"action": "closed", "pull_request": map[string]interface{}{"merged": true}}, "created_at": "2023-03-21T00:00:00Z"},
+		map[string]interface{}{"type": "WatchEvent", "actor": map[string]interface{}{"login": "frank"}, "created_at": "2023-03-21T00:00:00Z"},
+		map[string]interface{}{"type": "IssueCommentEvent", "actor": map[string]interface{}{"login": "outsider"}, "created_at": "2023-02-21T00:00:00Z"},
+	}
+
+	activity, err := f.provider().RepoActivity(context.Background(), "acme", "api", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, event := range activity {
+		got = append(got, event.Login+" "+event.Kind)
+	}
+	want := []string{"bob commit", "carol pull_request", "bob merge"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("activity = %v, want %v", got, want)
+	}
+	// Listing pull requests stops at the first page with one not updated
+	// since the start of the window.
+	if n := f.count("GET repos/acme/api/pulls"); n != 2 {
+		t.Errorf("pull request pages = %d, want 2", n)
+	}
+}
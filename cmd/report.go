@@ -0,0 +1,229 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+//go:embed templates/report.html
+var reportHTML string
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Render a report of the access configuration for auditors",
+	Long: `Render a report of the access configuration for auditors.
+
+The html format is a single static file, with its styles and script inline
+and no external assets, with a summary of the organization, the roles of its
+members, the team hierarchy, the effective permission of every user on every
+repository, the outside collaborators and a search box.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		out, _ := cmd.Flags().GetString("out")
+		if format != "html" {
+			log.Fatalf("Invalid --format %q: use html", format)
+		}
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		var w io.Writer = os.Stdout
+		if out != "-" {
+			file, err := os.Create(out)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			w = file
+		}
+		if err := renderHTMLReport(w, config, time.Now()); err != nil {
+			log.Fatalf("Failed to render the report: %v", err)
+		}
+		if out != "-" {
+			log.Printf("Report written to %s", out)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().String("format", "html", "Format of the report: html")
+	reportCmd.Flags().String("out", "access-report.html", "File to write the report to, - for stdout")
+}
+
+// reportData is what the HTML report template renders.
+type reportData struct {
+	Organization         OrganizationInfo
+	Generated            string
+	BasePermission       string
+	Owners               int
+	TeamCount            int
+	Members              []reportMember
+	Teams                []*reportTeam
+	Repositories         []string
+	Matrix               []reportRow
+	OutsideCollaborators []UserPermission
+}
+
+type reportMember struct {
+	Login string
+	Role  string
+	Teams []string
+}
+
+// reportTeam is a team of the team hierarchy.
+type reportTeam struct {
+	TeamInfo
+	Children []*reportTeam
+}
+
+// reportRow is the row of a user in the permission matrix, with a cell per
+// repository.
+type reportRow struct {
+	Login string
+	Cells []reportCell
+}
+
+type reportCell struct {
+	Access string
+	Grants string
+}
+
+// renderHTMLReport writes the HTML report of config to w.
+func renderHTMLReport(w io.Writer, config *AccessConfig, now time.Time) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{"join": strings.Join}).Parse(reportHTML)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, newReportData(config, now))
+}
+
+func newReportData(config *AccessConfig, now time.Time) reportData {
+	data := reportData{
+		Organization:   config.Organization,
+		Generated:      now.Format("2006-01-02 15:04 MST"),
+		BasePermission: config.Organization.DefaultRepositoryPermission,
+		TeamCount:      len(config.Teams),
+		Teams:          teamHierarchy(config),
+	}
+
+	graph := newTeamGraph(config)
+	members := make(map[string]bool)
+	for _, member := range config.Members {
+		members[strings.ToLower(member.Login)] = true
+		if strings.EqualFold(member.Role, "ADMIN") {
+			data.Owners++
+		}
+		var teams []string
+		for _, chain := range graph.chains(member.Login) {
+			if len(chain) == 1 {
+				teams = append(teams, chain[0])
+			}
+		}
+		data.Members = append(data.Members, reportMember{Login: member.Login, Role: member.Role, Teams: teams})
+	}
+
+	for _, permission := range config.Permissions.Users {
+		if !members[strings.ToLower(permission.Login)] {
+			data.OutsideCollaborators = append(data.OutsideCollaborators, permission)
+		}
+	}
+
+	columns := make(map[string]int)
+	for _, repo := range config.Repositories {
+		if _, ok := columns[strings.ToLower(repo.Name)]; !ok {
+			columns[strings.ToLower(repo.Name)] = len(data.Repositories)
+		}
+		data.Repositories = append(data.Repositories, repo.Name)
+	}
+	index := make(map[string]int)
+	for _, permission := range resolveEffectivePermissions(config) {
+		i, ok := index[strings.ToLower(permission.Login)]
+		if !ok {
+			i = len(data.Matrix)
+			index[strings.ToLower(permission.Login)] = i
+			data.Matrix = append(data.Matrix, reportRow{Login: permission.Login, Cells: make([]reportCell, len(data.Repositories))})
+		}
+		// Repositories only known from their permissions have no column.
+		if j, ok := columns[strings.ToLower(permission.Repo)]; ok {
+			var grants []string
+			for _, grant := range permission.Grants {
+				grants = append(grants, grant.Describe())
+			}
+			data.Matrix[i].Cells[j] = reportCell{Access: permission.Access, Grants: strings.Join(grants, "\n")}
+		}
+	}
+
+	return data
+}
+
+// teamHierarchy returns the teams without a parent with their child teams.
+// Teams only reachable through a cycle of child teams are added as roots.
+func teamHierarchy(config *AccessConfig) []*reportTeam {
+	isChild := make(map[string]bool)
+	for _, team := range config.Teams {
+		for _, child := range team.ChildTeams {
+			if childTeam := findTeam(config, child); childTeam != nil {
+				isChild[strings.ToLower(childTeam.Slug)] = true
+			}
+		}
+	}
+
+	visited := make(map[string]bool)
+	var build func(team *TeamInfo) *reportTeam
+	build = func(team *TeamInfo) *reportTeam {
+		visited[strings.ToLower(team.Slug)] = true
+		node := &reportTeam{TeamInfo: *team}
+		for _, child := range team.ChildTeams {
+			if childTeam := findTeam(config, child); childTeam != nil && !visited[strings.ToLower(childTeam.Slug)] {
+				node.Children = append(node.Children, build(childTeam))
+			}
+		}
+		return node
+	}
+
+	var roots []*reportTeam
+	for i := range config.Teams {
+		if !isChild[strings.ToLower(config.Teams[i].Slug)] {
+			roots = append(roots, build(&config.Teams[i]))
+		}
+	}
+	for i := range config.Teams {
+		if !visited[strings.ToLower(config.Teams[i].Slug)] {
+			roots = append(roots, build(&config.Teams[i]))
+		}
+	}
+	return roots
+}
@@ -0,0 +1,102 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hierarchyString flattens a team hierarchy as slug[children...].
+func hierarchyString(teams []*reportTeam) string {
+	var parts []string
+	for _, team := range teams {
+		parts = append(parts, fmt.Sprintf("%s%s", team.Slug, "["+hierarchyString(team.Children)+"]"))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTeamHierarchy(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	if got, want := hierarchyString(teamHierarchy(config)), "engineering[backend[] frontend[] platform[]] security[]"; got != want {
+		t.Errorf("hierarchy = %s, want %s", got, want)
+	}
+
+	// A cycle of child teams still lists every team once.
+	findTeam(config, "backend").ChildTeams = []string{"Engineering"}
+	if got, want := hierarchyString(teamHierarchy(config)), "security[] backend[engineering[frontend[] platform[]]]"; got != want {
+		t.Errorf("hierarchy with a cycle = %s, want %s", got, want)
+	}
+}
+
+func TestNewReportDataDirectTeams(t *testing.T) {
+	data := newReportData(exportNestedTeams(t), time.Now())
+
+	for _, member := range data.Members {
+		if member.Login == "erin" {
+			if want := []string{"platform", "on-call"}; !reflect.DeepEqual(member.Teams, want) {
+				t.Errorf("teams of erin = %v, want %v", member.Teams, want)
+			}
+			return
+		}
+	}
+	t.Error("erin is not in the report")
+}
+
+func TestRenderHTMLReport(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	findTeam(config, "frontend").Description = `<script>alert("x")</script>`
+
+	var out bytes.Buffer
+	if err := renderHTMLReport(&out, config, time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+
+	for _, want := range []string{
+		"<title>Access report: acme</title>",
+		"Generated 2023-05-01 12:00 UTC",
+		"<div><strong>6</strong>members</div>",
+		"<div><strong>1</strong>owners</div>",
+		"<tr><td>bob</td><td>MEMBER</td><td>backend</td></tr>",
+		"<tr><td>dave</td><td>MEMBER</td><td>engineering, frontend</td></tr>",
+		`<th>api</th><th>web</th><th>infra</th><th>docs</th><th>tools</th>`,
+		`<td class="MAINTAIN" title="MAINTAIN through team backend`,
+		"<tr><td>outsider</td><td>api</td><td class=\"READ\">READ</td></tr>",
+		`<input id="search"`,
+		"&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+
+	// The report is self-contained.
+	if external := regexp.MustCompile(`(?i)(src|href)\s*=|<link|@import|url\(`).FindString(html); external != "" {
+		t.Errorf("report references an external asset: %q", external)
+	}
+}
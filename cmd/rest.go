@@ -0,0 +1,206 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+// linkNextRegexp extracts the URL of the next page from a REST Link header.
+var linkNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// RESTError is returned when the REST API answers with a non 2xx status.
+type RESTError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e *RESTError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// isNotFound reports whether err is a REST 404.
+func isNotFound(err error) bool {
+	if restErr, ok := err.(*RESTError); ok {
+		return restErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// skipUnavailable reports whether the resource of a failed request can be
+// left out: on a REST 404, as the feature is not available, or on a 403, as
+// the token lacks scope. A 403 is logged as a warning naming the endpoint and
+// the scope it needs, so that the export is not silently incomplete.
+func skipUnavailable(err error, scope string) bool {
+	restErr, ok := err.(*RESTError)
+	if !ok {
+		return false
+	}
+	switch restErr.StatusCode {
+	case http.StatusNotFound:
+		return true
+	case http.StatusForbidden:
+		log.Printf("Warning: %s %s is forbidden (%s): the token needs %s. Leaving it out.\n", restErr.Method, restErr.URL, restErr.Message, scope)
+		return true
+	}
+	return false
+}
+
+// newHTTPClient returns an HTTP client authenticated for organization that
+// retries transient errors and waits out rate limits.
+func newHTTPClient(ctx context.Context, organization string) *http.Client {
+	if baseTransport != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: baseTransport})
+	}
+	client := oauth2.NewClient(ctx, tokenSource(ctx, organization))
+	client.Transport = newRateLimitTransport(client.Transport, viper.GetInt("max-retries"))
+	return client
+}
+
+// restURL builds an absolute REST URL from a path relative to URLREST.
+func restURL(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return strings.TrimSuffix(URLREST, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// restRequest sends a REST request and decodes the JSON response into out
+// (when out is not nil). It returns the URL of the next page, if any.
+func restRequest(ctx context.Context, client *http.Client, method string, path string, body interface{}, out interface{}) (string, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	url := restURL(path)
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	cached, isCached := etagEntry{}, false
+	if method == http.MethodGet {
+		cached, isCached = restETags.get(url)
+		if isCached {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		if out != nil && len(cached.Body) > 0 {
+			if err := json.Unmarshal(cached.Body, out); err != nil {
+				return "", fmt.Errorf("error decodificando la respuesta de %s: %w", url, err)
+			}
+		}
+		return cached.Next, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return "", &RESTError{Method: method, URL: url, StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return "", fmt.Errorf("error decodificando la respuesta de %s: %w", url, err)
+		}
+	}
+
+	next := ""
+	if match := linkNextRegexp.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		next = match[1]
+	}
+
+	if method == http.MethodGet {
+		restETags.put(url, etagEntry{ETag: resp.Header.Get("ETag"), Body: data, Next: next})
+	}
+	return next, nil
+}
+
+// restGet fetches a single REST resource.
+func restGet(ctx context.Context, client *http.Client, path string, out interface{}) error {
+	_, err := restRequest(ctx, client, http.MethodGet, path, nil, out)
+	return err
+}
+
+// restGetAll fetches every page of a REST list endpoint.
+func restGetAll[T any](ctx context.Context, client *http.Client, path string) ([]T, error) {
+	var all []T
+
+	next := path
+	if !strings.Contains(next, "per_page=") {
+		if strings.Contains(next, "?") {
+			next += "&per_page=100"
+		} else {
+			next += "?per_page=100"
+		}
+	}
+
+	for next != "" {
+		var page []T
+		var err error
+		next, err = restRequest(ctx, client, http.MethodGet, next, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+	}
+
+	return all, nil
+}
@@ -0,0 +1,383 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// moderatorRoleName is the name of the organization role granted to moderators.
+const moderatorRoleName = "moderator"
+
+// rolesCmd represents the roles command
+var rolesCmd = &cobra.Command{
+	Use:   "roles",
+	Short: "Manage the security manager and moderator roles of an organization",
+}
+
+// securityManagerCmd represents the roles security-manager command
+var securityManagerCmd = &cobra.Command{
+	Use:   "security-manager",
+	Short: "Grant or revoke the security manager role to a team",
+}
+
+var securityManagerAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Grant the security manager role to a team",
+	Run: func(cmd *cobra.Command, args []string) {
+		team, _ := cmd.Flags().GetString("team")
+		runRoleChange(func(ctx context.Context, provider Provider, organization string) error {
+			return provider.AddSecurityManager(ctx, organization, team)
+		})
+	},
+}
+
+var securityManagerRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Revoke the security manager role from a team",
+	Run: func(cmd *cobra.Command, args []string) {
+		team, _ := cmd.Flags().GetString("team")
+		runRoleChange(func(ctx context.Context, provider Provider, organization string) error {
+			return provider.RemoveSecurityManager(ctx, organization, team)
+		})
+	},
+}
+
+// moderatorCmd represents the roles moderator command
+var moderatorCmd = &cobra.Command{
+	Use:   "moderator",
+	Short: "Grant or revoke the moderator role to a user or a team",
+}
+
+var moderatorAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Grant the moderator role to a user or a team",
+	Run: func(cmd *cobra.Command, args []string) {
+		user, _ := cmd.Flags().GetString("user")
+		team, _ := cmd.Flags().GetString("team")
+		runRoleChange(func(ctx context.Context, provider Provider, organization string) error {
+			if user != "" {
+				user = resolveUser(organization, user)
+			}
+			return provider.SetModerator(ctx, organization, user, team, true)
+		})
+	},
+}
+
+var moderatorRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Revoke the moderator role from a user or a team",
+	Run: func(cmd *cobra.Command, args []string) {
+		user, _ := cmd.Flags().GetString("user")
+		team, _ := cmd.Flags().GetString("team")
+		runRoleChange(func(ctx context.Context, provider Provider, organization string) error {
+			if user != "" {
+				user = resolveUser(organization, user)
+			}
+			return provider.SetModerator(ctx, organization, user, team, false)
+		})
+	},
+}
+
+// rolesApplyCmd represents the roles apply command
+var rolesApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Reconcile security managers and moderators with the access configuration file",
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		ctx := context.Background()
+		if err := applyOrganizationRoles(ctx, mustGitHubProvider(ctx, config.Organization.Login), config, dryRun); err != nil {
+			log.Fatalf("Failed to apply organization roles: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rolesCmd)
+
+	rolesCmd.AddCommand(securityManagerCmd)
+	securityManagerCmd.AddCommand(securityManagerAddCmd, securityManagerRemoveCmd)
+	for _, c := range []*cobra.Command{securityManagerAddCmd, securityManagerRemoveCmd} {
+		c.Flags().StringP("team", "t", "", "Slug of the team")
+		c.MarkFlagRequired("team")
+	}
+
+	rolesCmd.AddCommand(moderatorCmd)
+	moderatorCmd.AddCommand(moderatorAddCmd, moderatorRemoveCmd)
+	for _, c := range []*cobra.Command{moderatorAddCmd, moderatorRemoveCmd} {
+		c.Flags().StringP("user", "u", "", "Login or corporate identity (NameID, SCIM username or email) of the user")
+		c.Flags().StringP("team", "t", "", "Slug of the team")
+		c.MarkFlagsMutuallyExclusive("user", "team")
+		c.PreRunE = requireUserOrTeam
+	}
+
+	rolesCmd.AddCommand(rolesApplyCmd)
+	rolesApplyCmd.Flags().Bool("dry-run", false, "Print the changes without applying them")
+}
+
+func requireUserOrTeam(cmd *cobra.Command, args []string) error {
+	user, _ := cmd.Flags().GetString("user")
+	team, _ := cmd.Flags().GetString("team")
+	if user == "" && team == "" {
+		return fmt.Errorf("one of --user or --team is required")
+	}
+	return nil
+}
+
+// runRoleChange runs a single role change against the target organization.
+func runRoleChange(change func(ctx context.Context, provider Provider, organization string) error) {
+	organization, err := targetOrganization()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := change(ctx, mustGitHubProvider(ctx, organization), organization); err != nil {
+		log.Fatalf("Failed to update roles for %s: %v", organization, err)
+	}
+	fmt.Println("Roles updated successfully for", organization)
+}
+
+// getSecurityManagers returns the slugs of the security manager teams of an
+// organization, never nil, as a nil list means the teams are unknown.
+func getSecurityManagers(ctx context.Context, client *http.Client, organization string) (RoleList, error) {
+	teams, err := restGetAll[struct {
+		Slug string `json:"slug"`
+	}](ctx, client, fmt.Sprintf("orgs/%s/security-managers", organization))
+	if err != nil {
+		return nil, err
+	}
+
+	securityManagers := RoleList{}
+	for _, team := range teams {
+		securityManagers = append(securityManagers, team.Slug)
+	}
+	return securityManagers, nil
+}
+
+// getModeratorRoleID looks up the ID of the moderator organization role.
+func getModeratorRoleID(ctx context.Context, client *http.Client, organization string) (int64, error) {
+	var roles struct {
+		Roles []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"roles"`
+	}
+
+	if err := restGet(ctx, client, fmt.Sprintf("orgs/%s/organization-roles", organization), &roles); err != nil {
+		return 0, err
+	}
+
+	for _, role := range roles.Roles {
+		if strings.EqualFold(role.Name, moderatorRoleName) {
+			return role.ID, nil
+		}
+	}
+
+	return 0, &RESTError{Method: http.MethodGet, URL: restURL(fmt.Sprintf("orgs/%s/organization-roles", organization)), StatusCode: http.StatusNotFound, Message: "moderator role not found"}
+}
+
+// getModerators returns the moderators of an organization, with lists that
+// are never nil, as a nil list means the moderators are unknown.
+func getModerators(ctx context.Context, client *http.Client, organization string) (ModeratorsInfo, error) {
+	moderators := ModeratorsInfo{Users: RoleList{}, Teams: RoleList{}}
+
+	roleID, err := getModeratorRoleID(ctx, client, organization)
+	if err != nil {
+		return ModeratorsInfo{}, err
+	}
+
+	users, err := restGetAll[struct {
+		Login string `json:"login"`
+	}](ctx, client, fmt.Sprintf("orgs/%s/organization-roles/%d/users", organization, roleID))
+	if err != nil {
+		return ModeratorsInfo{}, err
+	}
+	for _, user := range users {
+		moderators.Users = append(moderators.Users, user.Login)
+	}
+
+	teams, err := restGetAll[struct {
+		Slug string `json:"slug"`
+	}](ctx, client, fmt.Sprintf("orgs/%s/organization-roles/%d/teams", organization, roleID))
+	if err != nil {
+		return ModeratorsInfo{}, err
+	}
+	for _, team := range teams {
+		moderators.Teams = append(moderators.Teams, team.Slug)
+	}
+
+	return moderators, nil
+}
+
+func addSecurityManager(ctx context.Context, client *http.Client, organization string, team string) error {
+	_, err := restRequest(ctx, client, http.MethodPut, fmt.Sprintf("orgs/%s/security-managers/teams/%s", organization, team), nil, nil)
+	return err
+}
+
+func removeSecurityManager(ctx context.Context, client *http.Client, organization string, team string) error {
+	_, err := restRequest(ctx, client, http.MethodDelete, fmt.Sprintf("orgs/%s/security-managers/teams/%s", organization, team), nil, nil)
+	return err
+}
+
+// setModerator grants (PUT) or revokes (DELETE) the moderator role to a user or a team.
+func setModerator(ctx context.Context, client *http.Client, organization string, user string, team string, method string) error {
+	roleID, err := getModeratorRoleID(ctx, client, organization)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("orgs/%s/organization-roles/teams/%s/%d", organization, team, roleID)
+	if user != "" {
+		path = fmt.Sprintf("orgs/%s/organization-roles/users/%s/%d", organization, user, roleID)
+	}
+
+	_, err = restRequest(ctx, client, method, path, nil, nil)
+	return err
+}
+
+// applyOrganizationRoles makes the live security managers and moderators of
+// the organization match the access configuration. Lists missing from the
+// file are unknown, so their roles are left as they are: roles are only
+// revoked when the file lists their holders explicitly.
+func applyOrganizationRoles(ctx context.Context, provider Provider, config *AccessConfig, dryRun bool) error {
+	organization := config.Organization.Login
+	if organization == "" {
+		return fmt.Errorf("the access configuration has no organization login")
+	}
+
+	type change struct {
+		description string
+		apply       func() error
+	}
+	var changes []change
+
+	if config.SecurityManagers == nil {
+		fmt.Printf("%s: securityManagers is not in the file, leaving the security managers as they are\n", organization)
+	} else {
+		liveManagers, err := provider.SecurityManagers(ctx, organization)
+		if err != nil {
+			return err
+		}
+		toAdd, toRemove := diffStrings(liveManagers, config.SecurityManagers)
+		for _, team := range toAdd {
+			team := team
+			changes = append(changes, change{"add security manager team " + team, func() error { return provider.AddSecurityManager(ctx, organization, team) }})
+		}
+		for _, team := range toRemove {
+			team := team
+			changes = append(changes, change{"remove security manager team " + team, func() error { return provider.RemoveSecurityManager(ctx, organization, team) }})
+		}
+	}
+
+	if config.Moderators.Users == nil && config.Moderators.Teams == nil {
+		fmt.Printf("%s: moderators is not in the file, leaving the moderators as they are\n", organization)
+	} else {
+		liveModerators, err := provider.Moderators(ctx, organization)
+		if err != nil {
+			return err
+		}
+		for _, kind := range []struct {
+			name    string
+			live    RoleList
+			desired RoleList
+			set     func(name string, grant bool) error
+		}{
+			{"user", liveModerators.Users, config.Moderators.Users, func(user string, grant bool) error {
+				return provider.SetModerator(ctx, organization, user, "", grant)
+			}},
+			{"team", liveModerators.Teams, config.Moderators.Teams, func(team string, grant bool) error {
+				return provider.SetModerator(ctx, organization, "", team, grant)
+			}},
+		} {
+			if kind.desired == nil {
+				fmt.Printf("%s: moderators.%ss is not in the file, leaving the moderator %ss as they are\n", organization, kind.name, kind.name)
+				continue
+			}
+			toAdd, toRemove := diffStrings(kind.live, kind.desired)
+			for _, name := range toAdd {
+				name, set := name, kind.set
+				changes = append(changes, change{"add moderator " + kind.name + " " + name, func() error { return set(name, true) }})
+			}
+			for _, name := range toRemove {
+				name, set := name, kind.set
+				changes = append(changes, change{"remove moderator " + kind.name + " " + name, func() error { return set(name, false) }})
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("Organization roles are up to date for", organization)
+		return nil
+	}
+
+	for _, c := range changes {
+		if dryRun {
+			fmt.Printf("[dry-run] %s: %s\n", organization, c.description)
+			continue
+		}
+		if err := c.apply(); err != nil {
+			return fmt.Errorf("%s: %w", c.description, err)
+		}
+		fmt.Printf("%s: %s\n", organization, c.description)
+	}
+
+	return nil
+}
+
+// diffStrings returns the values of desired missing from current, and the
+// values of current missing from desired.
+func diffStrings(current []string, desired []string) (toAdd []string, toRemove []string) {
+	currentSet := make(map[string]bool, len(current))
+	for _, value := range current {
+		currentSet[strings.ToLower(value)] = true
+	}
+	desiredSet := make(map[string]bool, len(desired))
+	for _, value := range desired {
+		desiredSet[strings.ToLower(value)] = true
+	}
+
+	for _, value := range desired {
+		if !currentSet[strings.ToLower(value)] {
+			toAdd = append(toAdd, value)
+		}
+	}
+	for _, value := range current {
+		if !desiredSet[strings.ToLower(value)] {
+			toRemove = append(toRemove, value)
+		}
+	}
+	return toAdd, toRemove
+}
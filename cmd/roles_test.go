@@ -0,0 +1,103 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportOrganizationLeavesOutUnknownRoles(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.forbidden = append(f.forbidden, "orgs/acme/security-managers")
+
+	got, _, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	if got.SecurityManagers != nil {
+		t.Errorf("security managers = %q, want unknown", got.SecurityManagers)
+	}
+	if want := (ModeratorsInfo{Users: RoleList{"alice"}, Teams: RoleList{"platform"}}); !reflect.DeepEqual(got.Moderators, want) {
+		t.Errorf("moderators = %+v, want %+v", got.Moderators, want)
+	}
+
+	data, err := yaml.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "securityManagers") {
+		t.Error("unknown security managers were written")
+	}
+}
+
+func TestRoleListMarshalsEmptyLists(t *testing.T) {
+	config := &AccessConfig{SecurityManagers: RoleList{}, Moderators: ModeratorsInfo{Users: RoleList{}}}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "securityManagers: []\nmoderators:\n    users: []\n"; string(data) != want {
+		t.Errorf("yaml = %q, want %q", data, want)
+	}
+
+	var loaded AccessConfig
+	if err := yaml.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.SecurityManagers == nil || loaded.Moderators.Users == nil || loaded.Moderators.Teams != nil {
+		t.Errorf("loaded roles = %#v, %#v", loaded.SecurityManagers, loaded.Moderators)
+	}
+}
+
+func TestApplyOrganizationRoles(t *testing.T) {
+	live := loadFixture(t, "acme.yaml")
+	f := newFakeGitHub(t, 2, live)
+	provider := f.provider()
+
+	// A file without roles, such as one exported with a token that cannot
+	// read them, leaves every role as it is.
+	config := &AccessConfig{Organization: OrganizationInfo{Login: "acme"}}
+	if err := applyOrganizationRoles(context.Background(), provider, config, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(live.SecurityManagers, RoleList{"security"}) || !reflect.DeepEqual(live.Moderators.Users, RoleList{"alice"}) {
+		t.Errorf("roles changed: %q, %+v", live.SecurityManagers, live.Moderators)
+	}
+
+	// Explicit lists are reconciled, an empty one revoking the role from everyone.
+	config.SecurityManagers = RoleList{"platform"}
+	config.Moderators.Users = RoleList{}
+	if err := applyOrganizationRoles(context.Background(), provider, config, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(live.SecurityManagers, RoleList{"platform"}) {
+		t.Errorf("security managers = %q, want [platform]", live.SecurityManagers)
+	}
+	if len(live.Moderators.Users) != 0 || !reflect.DeepEqual(live.Moderators.Teams, RoleList{"platform"}) {
+		t.Errorf("moderators = %+v, want only the platform team", live.Moderators)
+	}
+}
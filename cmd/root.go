@@ -25,7 +25,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -55,6 +54,9 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		reportRateLimits()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -71,15 +73,33 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.gh-aac.yaml)")
 
-	rootCmd.PersistentFlags().StringVarP(&endpoint, "endpoint", "e", "", "XW NO SALEEE.")
+	rootCmd.PersistentFlags().String("profile", "", "Profile of the config file to use. By default the profile key of the config file.")
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+
+	rootCmd.PersistentFlags().StringVarP(&endpoint, "endpoint", "e", "", "GitHub host: github.com (default), <subdomain>.ghe.com or the URL of a GitHub Enterprise Server.")
 	viper.BindPFlag("endpoint", rootCmd.PersistentFlags().Lookup("endpoint"))
 
 	rootCmd.PersistentFlags().StringVarP(&org, "organization", "o", "", "Slug organization name. By default from conf file.")
 	viper.BindPFlag("organization", rootCmd.PersistentFlags().Lookup("organization"))
 
-	rootCmd.PersistentFlags().StringVarP(&aacFormatType, "aac-format", "f", "", "It defines the format of the access as code (aac) output file. By default is YAML. It can be YAML or JSON.")
+	rootCmd.PersistentFlags().StringVarP(&aacFormatType, "aac-format", "f", "", "Format of the access as code (aac) output file, YAML by default.")
 	viper.BindPFlag("aac-format", rootCmd.PersistentFlags().Lookup("aac-format"))
 	viper.SetDefault("aac-format", "yaml")
+	rootCmd.RegisterFlagCompletionFunc("aac-format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return formatNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	// Formats register themselves in the init of their files, which may run
+	// after this one, so the usage of --aac-format lists them when the help or
+	// the usage is printed.
+	help, usage := rootCmd.HelpFunc(), rootCmd.UsageFunc()
+	rootCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		rootCmd.PersistentFlags().Lookup("aac-format").Usage = aacFormatUsage()
+		help(cmd, args)
+	})
+	rootCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		rootCmd.PersistentFlags().Lookup("aac-format").Usage = aacFormatUsage()
+		return usage(cmd)
+	})
 
 	rootCmd.PersistentFlags().StringVarP(&aacFilePath, "aac-path", "p", "", "Path to the output YAML file")
 	viper.BindPFlag("aac-path", rootCmd.PersistentFlags().Lookup("aac-path"))
@@ -87,6 +107,31 @@ func init() {
 
 	rootCmd.MarkFlagFilename("aac-path", "yaml")
 
+	rootCmd.PersistentFlags().Int("max-retries", defaultMaxRetries, "Maximum number of retries of a GitHub request after a transient error or a rate limit.")
+	viper.BindPFlag("max-retries", rootCmd.PersistentFlags().Lookup("max-retries"))
+
+	rootCmd.PersistentFlags().String("identity-path", "", "Path to the identity map file. By default identity-map.yaml next to the aac file.")
+	viper.BindPFlag("identity-path", rootCmd.PersistentFlags().Lookup("identity-path"))
+
+	rootCmd.PersistentFlags().String("ca-bundle", "", "PEM file with additional CA certificates to trust, for GitHub Enterprise Server with a private CA.")
+	viper.BindPFlag("ca-bundle", rootCmd.PersistentFlags().Lookup("ca-bundle"))
+
+	rootCmd.PersistentFlags().String("proxy", "", "Proxy URL for GitHub requests. By default from HTTPS_PROXY, HTTP_PROXY and NO_PROXY.")
+	viper.BindPFlag("proxy", rootCmd.PersistentFlags().Lookup("proxy"))
+
+	rootCmd.PersistentFlags().String("token", "", "GitHub token. By default from GH_TOKEN, GITHUB_TOKEN, GH_ENTERPRISE_TOKEN, the config file, the gh CLI or credential-command.")
+	viper.BindPFlag("token", rootCmd.PersistentFlags().Lookup("token"))
+
+	rootCmd.PersistentFlags().String("credential-command", "", "Command printing a GitHub token, used when no other token is found. The host is passed in GH_AAC_HOST.")
+	viper.BindPFlag("credential-command", rootCmd.PersistentFlags().Lookup("credential-command"))
+
+	rootCmd.PersistentFlags().String("app-id", "", "Authenticate as the GitHub App with this ID instead of a token. The installation of each organization is found automatically.")
+	viper.BindPFlag("app-id", rootCmd.PersistentFlags().Lookup("app-id"))
+
+	rootCmd.PersistentFlags().String("app-private-key", "", "Path to the PEM private key of the GitHub App.")
+	viper.BindPFlag("app-private-key", rootCmd.PersistentFlags().Lookup("app-private-key"))
+	rootCmd.MarkFlagFilename("app-private-key", "pem")
+
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -112,17 +157,26 @@ func initConfig() {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 
+	// The profile is resolved first, as it can set any of the settings below.
+	cobra.CheckErr(applyProfile(viper.GetViper(), viper.GetString("profile")))
+	if viper.GetString("profile") != "" {
+		log.Printf("Profile: %s", viper.GetString("profile"))
+	}
+	aacFormatType = viper.GetString("aac-format")
+	_, err := currentFormat()
+	cobra.CheckErr(err)
+
 	if viper.GetString("endpoint") == "" {
 		// By default http://github.com
 		viper.Set("endpoint", "https://github.com")
-
-		URLGRAPHQL = "https://api.github.com/graphql"
-		URLREST = "https://api.github.com"
-	} else {
-		URLREST = fmt.Sprintf("%s/api/v3", viper.GetString("endpoint"))
-		URLGRAPHQL = fmt.Sprintf("https://api.%s/graphql", strings.Replace(viper.GetString("endpoint"), "https://", "", 1))
 	}
 
+	URLGRAPHQL, URLREST, err = resolveEndpoint(viper.GetString("endpoint"))
+	cobra.CheckErr(err)
+
+	baseTransport, err = newBaseTransport(viper.GetString("ca-bundle"), viper.GetString("proxy"))
+	cobra.CheckErr(err)
+
 	if viper.GetString("organization") != "" {
 		organizationList = append(organizationList, viper.GetString("organization"))
 	} else {
@@ -132,3 +186,11 @@ func initConfig() {
 	// print endpoint
 	log.Printf("Endpoint: %s", viper.GetString("endpoint"))
 }
+
+// targetOrganization returns the single organization a command acts on.
+func targetOrganization() (string, error) {
+	if len(organizationList) != 1 {
+		return "", fmt.Errorf("expected exactly one organization, got %d: use --organization", len(organizationList))
+	}
+	return organizationList[0], nil
+}
@@ -0,0 +1,399 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Columns of each sheet. They are part of the CSV format that sheets import
+// reads back, so they only ever grow at the end.
+var sheetColumns = map[string][]string{
+	"members":          {"login", "role"},
+	"teams":            {"slug", "name", "description", "child_teams", "idp_managed"},
+	"team_members":     {"team", "login"},
+	"team_permissions": {"repo", "team", "access"},
+	"user_permissions": {"repo", "login", "access"},
+}
+
+// sheetNames are the sheets in the order they are written.
+var sheetNames = []string{"members", "teams", "team_members", "team_permissions", "user_permissions"}
+
+// sheetsCmd represents the sheets command
+var sheetsCmd = &cobra.Command{
+	Use:   "sheets",
+	Short: "Convert the access configuration to and from spreadsheets",
+	Long: `Convert the access configuration to and from spreadsheets.
+
+The members, teams, team memberships, team permissions and user permissions
+of the access configuration are flattened into one table each, with these
+columns:
+
+  members           login, role
+  teams             slug, name, description, child_teams, idp_managed
+  team_members      team, login
+  team_permissions  repo, team, access
+  user_permissions  repo, login, access
+
+child_teams lists the names of the child teams separated by semicolons.`,
+}
+
+// sheetsExportCmd represents the sheets export command
+var sheetsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the access configuration as CSV files or an XLSX workbook",
+	Long: `Write the access configuration as CSV files or an XLSX workbook.
+
+With --format csv, --out is a directory that gets a file per table, such as
+members.csv. With --format xlsx, --out is a workbook with a sheet per table.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		out, _ := cmd.Flags().GetString("out")
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		sheets := configSheets(config)
+		switch format {
+		case "csv":
+			if out == "" {
+				out = "access-config-csv"
+			}
+			err = writeCSVSheets(out, sheets)
+		case "xlsx":
+			if out == "" {
+				out = "access-config.xlsx"
+			}
+			err = writeXLSXFile(out, sheets)
+		default:
+			log.Fatalf("Invalid --format %q: use csv or xlsx", format)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write %s: %v", out, err)
+		}
+		log.Printf("Access configuration written to %s", out)
+	},
+}
+
+// sheetsImportCmd represents the sheets import command
+var sheetsImportCmd = &cobra.Command{
+	Use:   "import <directory>",
+	Short: "Read the CSV files of sheets export back into the access configuration",
+	Long: `Read the CSV files of sheets export back into the access configuration.
+
+The members, teams and permissions of the access configuration file are
+replaced with the ones of the CSV files, and the rest of the file, such as
+the repositories, the webhooks and the IDs, IdP groups and maintainers of
+the teams, is kept.
+Without an access configuration file, a new one is written.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := viper.GetString("aac-path")
+
+		config := &AccessConfig{}
+		if _, err := os.Stat(path); err == nil {
+			if config, err = LoadConfig(path); err != nil {
+				log.Fatalf("Failed to load config: %v", err)
+			}
+		}
+		if config.Organization.Login == "" {
+			if organization, err := targetOrganization(); err == nil {
+				config.Organization.Login = organization
+			}
+		}
+
+		sheets, err := readCSVSheets(args[0])
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", args[0], err)
+		}
+		if err := applySheets(config, sheets); err != nil {
+			log.Fatalf("Failed to import %s: %v", args[0], err)
+		}
+
+		data, err := marshalConfig(config, configFormat(path))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		log.Printf("Imported %s into %s", args[0], path)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sheetsCmd)
+	sheetsCmd.AddCommand(sheetsExportCmd, sheetsImportCmd)
+	sheetsExportCmd.Flags().String("format", "csv", "Format of the tables: csv or xlsx")
+	sheetsExportCmd.Flags().String("out", "", "Directory of the CSV files or path of the workbook")
+}
+
+// sheet is a table of the access configuration, with a row per entry.
+type sheet struct {
+	Name string
+	Rows [][]string
+}
+
+// configSheets flattens config into its sheets.
+func configSheets(config *AccessConfig) []sheet {
+	sheets := make(map[string]*sheet)
+	for _, name := range sheetNames {
+		sheets[name] = &sheet{Name: name}
+	}
+	add := func(name string, row ...string) {
+		sheets[name].Rows = append(sheets[name].Rows, row)
+	}
+
+	for _, member := range config.Members {
+		add("members", member.Login, member.Role)
+	}
+	for _, team := range config.Teams {
+		add("teams", team.Slug, team.Name, team.Description, strings.Join(team.ChildTeams, ";"), strconv.FormatBool(team.IdPManaged))
+		for _, login := range team.Members {
+			add("team_members", team.Slug, login)
+		}
+	}
+	for _, permission := range config.Permissions.Teams {
+		add("team_permissions", permission.Repo, permission.Slug, permission.Access)
+	}
+	for _, permission := range config.Permissions.Users {
+		add("user_permissions", permission.Repo, permission.Login, permission.Access)
+	}
+
+	var ordered []sheet
+	for _, name := range sheetNames {
+		ordered = append(ordered, *sheets[name])
+	}
+	return ordered
+}
+
+// applySheets replaces the members, teams and permissions of config with the
+// ones of sheets, keeping the IDs, privacy, IdP groups and maintainers of the
+// teams that remain.
+func applySheets(config *AccessConfig, sheets []sheet) error {
+	rows := make(map[string][][]string)
+	for _, sheet := range sheets {
+		rows[sheet.Name] = sheet.Rows
+	}
+
+	var members []MemberInfo
+	for i, row := range rows["members"] {
+		role := strings.ToUpper(row[1])
+		if role != "ADMIN" && role != "MEMBER" {
+			return fmt.Errorf("members row %d: invalid role %q: use ADMIN or MEMBER", i+2, row[1])
+		}
+		members = append(members, MemberInfo{Login: row[0], Role: role})
+	}
+
+	var teams []TeamInfo
+	for i, row := range rows["teams"] {
+		team := TeamInfo{Slug: row[0], Name: row[1], Description: row[2]}
+		if row[3] != "" {
+			for _, child := range strings.Split(row[3], ";") {
+				team.ChildTeams = append(team.ChildTeams, strings.TrimSpace(child))
+			}
+		}
+		if row[4] != "" {
+			managed, err := strconv.ParseBool(row[4])
+			if err != nil {
+				return fmt.Errorf("teams row %d: invalid idp_managed %q", i+2, row[4])
+			}
+			team.IdPManaged = managed
+		}
+		if previous := findTeam(config, team.Slug); previous != nil {
+			team.DatabaseID = previous.DatabaseID
+			team.Privacy = previous.Privacy
+			team.IdPGroups = previous.IdPGroups
+		}
+		teams = append(teams, team)
+	}
+	imported := &AccessConfig{Teams: teams}
+	for i, row := range rows["team_members"] {
+		team := findTeam(imported, row[0])
+		if team == nil {
+			return fmt.Errorf("team_members row %d: unknown team %q", i+2, row[0])
+		}
+		team.Members = append(team.Members, row[1])
+	}
+	// The sheets have no team roles: the maintainers that remain members
+	// keep their role.
+	for i := range imported.Teams {
+		team := &imported.Teams[i]
+		if previous := findTeam(config, team.Slug); previous != nil {
+			for _, login := range previous.Maintainers {
+				if containsFold(team.Members, login) {
+					team.Maintainers = append(team.Maintainers, login)
+				}
+			}
+		}
+	}
+
+	// The membership of IdP-managed teams comes from the identity provider.
+	for _, team := range imported.Teams {
+		var previous []string
+		if previousTeam := findTeam(config, team.Slug); previousTeam != nil {
+			previous = previousTeam.Members
+		}
+		if toAdd, toRemove := diffStrings(previous, team.Members); len(toAdd) > 0 || len(toRemove) > 0 {
+			if err := checkTeamMembershipEditable(config, team.Slug); err != nil {
+				return fmt.Errorf("team_members: %w", err)
+			}
+		}
+	}
+
+	var permissions PermissionsInfo
+	for i, row := range rows["team_permissions"] {
+		if findTeam(imported, row[1]) == nil {
+			return fmt.Errorf("team_permissions row %d: unknown team %q", i+2, row[1])
+		}
+		if permissionRank(row[2]) == 0 {
+			return fmt.Errorf("team_permissions row %d: invalid access %q", i+2, row[2])
+		}
+		permissions.Teams = append(permissions.Teams, TeamPermission{Repo: row[0], Slug: row[1], Access: strings.ToUpper(row[2])})
+	}
+	for i, row := range rows["user_permissions"] {
+		if permissionRank(row[2]) == 0 {
+			return fmt.Errorf("user_permissions row %d: invalid access %q", i+2, row[2])
+		}
+		permissions.Users = append(permissions.Users, UserPermission{Repo: row[0], Login: row[1], Access: strings.ToUpper(row[2])})
+	}
+
+	config.Members = members
+	config.Teams = imported.Teams
+	config.Permissions = permissions
+	return nil
+}
+
+// writeCSVSheets writes each sheet to dir as name.csv with a header row.
+func writeCSVSheets(dir string, sheets []sheet) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, sheet := range sheets {
+		file, err := os.Create(filepath.Join(dir, sheet.Name+".csv"))
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(file)
+		w.Write(sheetColumns[sheet.Name])
+		for _, row := range sheet.Rows {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				cells[i] = escapeCSVFormula(cell)
+			}
+			w.Write(cells)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCSVSheets reads the CSV files of writeCSVSheets from dir. Columns are
+// matched by their header, so they may be reordered, and extra columns are
+// ignored. Every row is returned with the columns of sheetColumns.
+func readCSVSheets(dir string) ([]sheet, error) {
+	var sheets []sheet
+	for _, name := range sheetNames {
+		file, err := os.Open(filepath.Join(dir, name+".csv"))
+		if err != nil {
+			return nil, err
+		}
+		r := csv.NewReader(file)
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s.csv: %w", name, err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("%s.csv: missing header", name)
+		}
+
+		header := make(map[string]int)
+		for i, column := range records[0] {
+			header[strings.TrimSpace(strings.ToLower(column))] = i
+		}
+		var indexes []int
+		for _, column := range sheetColumns[name] {
+			i, ok := header[column]
+			if !ok {
+				return nil, fmt.Errorf("%s.csv: missing column %s", name, column)
+			}
+			indexes = append(indexes, i)
+		}
+
+		current := sheet{Name: name}
+		for _, record := range records[1:] {
+			row := make([]string, len(indexes))
+			empty := true
+			for j, i := range indexes {
+				if i < len(record) {
+					row[j] = unescapeCSVFormula(strings.TrimSpace(record[i]))
+				}
+				empty = empty && row[j] == ""
+			}
+			// Spreadsheets often save trailing empty rows.
+			if !empty {
+				current.Rows = append(current.Rows, row)
+			}
+		}
+		sheets = append(sheets, current)
+	}
+	return sheets, nil
+}
+
+// escapeCSVFormula prefixes with a quote the cells that spreadsheets would
+// evaluate as formulas, such as a team description starting with "=". Cells
+// starting with a quote are prefixed too, so that unescapeCSVFormula can tell
+// them apart from the quotes it added.
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("'=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeCSVFormula removes the quote added by escapeCSVFormula.
+func unescapeCSVFormula(cell string) string {
+	if strings.HasPrefix(cell, "'") && escapeCSVFormula(cell[1:]) != cell[1:] {
+		return cell[1:]
+	}
+	return cell
+}
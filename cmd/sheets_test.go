@@ -0,0 +1,206 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSheetsCSVRoundTrip(t *testing.T) {
+	want := loadFixture(t, "acme.yaml")
+	dir := t.TempDir()
+	if err := writeCSVSheets(dir, configSheets(want)); err != nil {
+		t.Fatal(err)
+	}
+
+	sheets, err := readCSVSheets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := loadFixture(t, "acme.yaml")
+	got.Members, got.Permissions = nil, PermissionsInfo{}
+	// IDs, privacy, IdP groups and maintainers are not in the sheets, they
+	// are kept from the file.
+	for i := range got.Teams {
+		got.Teams[i] = TeamInfo{Slug: got.Teams[i].Slug, DatabaseID: got.Teams[i].DatabaseID, Privacy: got.Teams[i].Privacy, IdPGroups: got.Teams[i].IdPGroups, Maintainers: got.Teams[i].Maintainers}
+	}
+	if err := applySheets(got, sheets); err != nil {
+		t.Fatal(err)
+	}
+	assertSameConfig(t, got, want)
+}
+
+func TestWriteCSVSheetsEscapesFormulas(t *testing.T) {
+	want := &AccessConfig{Teams: []TeamInfo{
+		{Slug: "ops", Name: "Ops", Description: "=HYPERLINK(\"https://evil.example\")"},
+		{Slug: "qa", Name: "@qa", Description: "- testers +1"},
+		{Slug: "legacy", Name: "'=legacy", Description: "'quoted"},
+	}}
+	dir := t.TempDir()
+	if err := writeCSVSheets(dir, configSheets(want)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "teams.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range []string{`"'=HYPERLINK(""https://evil.example"")"`, "'@qa", "'- testers +1", "''=legacy", "''quoted"} {
+		if !strings.Contains(string(data), cell) {
+			t.Errorf("teams.csv = %s, want it to contain %s", data, cell)
+		}
+	}
+
+	sheets, err := readCSVSheets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &AccessConfig{}
+	if err := applySheets(got, sheets); err != nil {
+		t.Fatal(err)
+	}
+	assertSameConfig(t, got, want)
+}
+
+func TestReadCSVSheetsMatchesColumnsByHeader(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeCSVSheets(dir, configSheets(&AccessConfig{})); err != nil {
+		t.Fatal(err)
+	}
+	edited := "Access,Login,notes,Repo\nwrite,bob,temporary,api\n,,,\n"
+	if err := os.WriteFile(filepath.Join(dir, "user_permissions.csv"), []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sheets, err := readCSVSheets(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &AccessConfig{}
+	if err := applySheets(config, sheets); err != nil {
+		t.Fatal(err)
+	}
+	want := []UserPermission{{Repo: "api", Login: "bob", Access: "WRITE"}}
+	if !reflect.DeepEqual(config.Permissions.Users, want) {
+		t.Errorf("user permissions = %+v, want %+v", config.Permissions.Users, want)
+	}
+}
+
+func TestApplySheetsErrors(t *testing.T) {
+	tests := map[string]sheet{
+		"unknown team":   {Name: "team_members", Rows: [][]string{{"ghosts", "bob"}}},
+		"invalid access": {Name: "user_permissions", Rows: [][]string{{"api", "bob", "PUSH"}}},
+		"invalid role":   {Name: "members", Rows: [][]string{{"bob", "OWNER"}}},
+	}
+	for name, bad := range tests {
+		if err := applySheets(&AccessConfig{}, []sheet{bad}); err == nil || !strings.Contains(err.Error(), "row 2") {
+			t.Errorf("%s: error = %v, want one pointing to row 2", name, err)
+		}
+	}
+
+	if _, err := readCSVSheets(t.TempDir()); err == nil {
+		t.Error("reading a directory without the CSV files succeeded")
+	}
+}
+
+func TestApplySheetsKeepsIdPManagedMembership(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	sheets := configSheets(config)
+	if err := applySheets(config, sheets); err != nil {
+		t.Fatalf("unchanged sheets: %v", err)
+	}
+
+	for i := range sheets {
+		if sheets[i].Name == "team_members" {
+			sheets[i].Rows = append(sheets[i].Rows, []string{"platform", "bob"})
+		}
+	}
+	err := applySheets(config, sheets)
+	if err == nil || !strings.Contains(err.Error(), "managed by the identity provider") {
+		t.Errorf("error = %v, want one about the IdP-managed platform team", err)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeXLSX(&out, configSheets(loadFixture(t, "acme.yaml"))); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, file := range z.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		parts[file.Name] = string(data)
+
+		// Every part is well-formed XML.
+		decoder := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", file.Name, err)
+			}
+		}
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet5.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("workbook has no %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="team_permissions" sheetId="4" r:id="rId4"/>`) {
+		t.Errorf("workbook.xml = %s", parts["xl/workbook.xml"])
+	}
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">login</t></is></c>`,
+		`<c r="B2" t="inlineStr"><is><t xml:space="preserve">ADMIN</t></is></c>`,
+	} {
+		if !strings.Contains(parts["xl/worksheets/sheet1.xml"], want) {
+			t.Errorf("members sheet does not contain %s", want)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// teamSyncCmd represents the team-sync command
+var teamSyncCmd = &cobra.Command{
+	Use:   "team-sync",
+	Short: "Manage the identity provider groups synchronized to teams",
+}
+
+// teamSyncGroupsCmd represents the team-sync groups command
+var teamSyncGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "List the identity provider groups available to the organization",
+	Run: func(cmd *cobra.Command, args []string) {
+		organization, err := targetOrganization()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		groups, err := mustGitHubProvider(ctx, organization).IdPGroups(ctx, organization)
+		if err != nil {
+			log.Fatalf("Failed to list identity provider groups for %s: %v", organization, err)
+		}
+		for _, group := range groups {
+			fmt.Printf("%s\t%s\t%s\n", group.ID, group.Name, group.Description)
+		}
+	},
+}
+
+// teamSyncApplyCmd represents the team-sync apply command
+var teamSyncApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Set or remove team synchronization mappings from the access configuration file",
+	Long: `Set or remove team synchronization mappings from the access configuration file.
+
+Every team listed in the file with idpGroups gets exactly those groups mapped.
+Every team listed in the file with an empty idpGroups list ([]) gets its
+mapping removed. Teams without idpGroups, such as the ones of an export whose
+token could not read the mappings, are left as they are.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		ctx := context.Background()
+		if err := applyTeamSyncMappings(ctx, mustGitHubProvider(ctx, config.Organization.Login), config, dryRun); err != nil {
+			log.Fatalf("Failed to apply team sync mappings: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(teamSyncCmd)
+	teamSyncCmd.AddCommand(teamSyncGroupsCmd, teamSyncApplyCmd)
+	teamSyncApplyCmd.Flags().Bool("dry-run", false, "Print the changes without applying them")
+}
+
+// restIdPGroup is the REST representation of a team synchronization group.
+type restIdPGroup struct {
+	GroupID          string `json:"group_id"`
+	GroupName        string `json:"group_name"`
+	GroupDescription string `json:"group_description"`
+}
+
+type restIdPGroupList struct {
+	Groups []restIdPGroup `json:"groups"`
+}
+
+// toIdPGroupInfos converts groups, returning an empty list rather than nil
+// when there are none.
+func toIdPGroupInfos(groups []restIdPGroup) IdPGroupList {
+	infos := IdPGroupList{}
+	for _, group := range groups {
+		infos = append(infos, IdPGroupInfo{
+			ID:          group.GroupID,
+			Name:        group.GroupName,
+			Description: group.GroupDescription,
+		})
+	}
+	return infos
+}
+
+func getIdPGroups(ctx context.Context, client *http.Client, organization string) ([]IdPGroupInfo, error) {
+	var groups []restIdPGroup
+
+	next := fmt.Sprintf("orgs/%s/team-sync/groups?per_page=100", organization)
+	for next != "" {
+		var page restIdPGroupList
+		var err error
+		next, err = restRequest(ctx, client, http.MethodGet, next, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, page.Groups...)
+	}
+
+	return toIdPGroupInfos(groups), nil
+}
+
+func getTeamSyncMapping(ctx context.Context, client *http.Client, organization string, slug string) ([]IdPGroupInfo, error) {
+	var mapping restIdPGroupList
+
+	err := restGet(ctx, client, fmt.Sprintf("orgs/%s/teams/%s/team-sync/group-mappings", organization, slug), &mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return toIdPGroupInfos(mapping.Groups), nil
+}
+
+func setTeamSyncMapping(ctx context.Context, client *http.Client, organization string, slug string, groups []IdPGroupInfo) error {
+	body := restIdPGroupList{Groups: []restIdPGroup{}}
+	for _, group := range groups {
+		body.Groups = append(body.Groups, restIdPGroup{
+			GroupID:          group.ID,
+			GroupName:        group.Name,
+			GroupDescription: group.Description,
+		})
+	}
+
+	_, err := restRequest(ctx, client, http.MethodPatch, fmt.Sprintf("orgs/%s/teams/%s/team-sync/group-mappings", organization, slug), body, nil)
+	return err
+}
+
+// isTeamSyncEnabled reports whether team synchronization is available to the organization.
+func isTeamSyncEnabled(ctx context.Context, client *http.Client, organization string) (bool, error) {
+	_, err := restRequest(ctx, client, http.MethodGet, fmt.Sprintf("orgs/%s/team-sync/groups?per_page=1", organization), nil, nil)
+	if err != nil {
+		if skipUnavailable(err, "the read:org scope") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// getTeamSyncMappings fills the identity provider groups of every team, with
+// an empty list for the teams without a mapping. It leaves them nil, as
+// unknown, when team synchronization is not enabled for the organization or
+// the token cannot read it.
+func getTeamSyncMappings(ctx context.Context, pool *workerPool, provider Provider, organization string, teams []TeamInfo) error {
+	enabled, err := provider.TeamSyncEnabled(ctx, organization)
+	if err != nil || !enabled {
+		return err
+	}
+
+	g := newTaskGroup(pool)
+	for i := range teams {
+		team := &teams[i]
+		g.Go(func() error {
+			groups, err := provider.TeamSyncMapping(ctx, organization, team.Slug)
+			if err != nil {
+				return fmt.Errorf("team %s: %w", team.Slug, err)
+			}
+			team.IdPGroups = IdPGroupList{}
+			team.IdPGroups = append(team.IdPGroups, groups...)
+			team.IdPManaged = len(groups) > 0
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// applyTeamSyncMappings makes the live team synchronization mappings match
+// the teams of the access configuration.
+func applyTeamSyncMappings(ctx context.Context, provider Provider, config *AccessConfig, dryRun bool) error {
+	organization := config.Organization.Login
+	if organization == "" {
+		return fmt.Errorf("the access configuration has no organization login")
+	}
+
+	changed := false
+	for _, team := range config.Teams {
+		if team.Slug == "" {
+			log.Printf("Skipping team %q without slug\n", team.Name)
+			continue
+		}
+		if team.IdPGroups == nil {
+			log.Printf("idpGroups of team %s is not in the file, leaving its mapping as it is\n", team.Slug)
+			continue
+		}
+
+		live, err := provider.TeamSyncMapping(ctx, organization, team.Slug)
+		if err != nil {
+			return fmt.Errorf("team %s: %w", team.Slug, err)
+		}
+		if sameIdPGroups(live, team.IdPGroups) {
+			continue
+		}
+		changed = true
+
+		description := fmt.Sprintf("map team %s to %s", team.Slug, idpGroupNames(team.IdPGroups))
+		if len(team.IdPGroups) == 0 {
+			description = fmt.Sprintf("remove the mapping of team %s", team.Slug)
+		}
+
+		if dryRun {
+			fmt.Printf("[dry-run] %s: %s\n", organization, description)
+			continue
+		}
+		if err := provider.SetTeamSyncMapping(ctx, organization, team.Slug, team.IdPGroups); err != nil {
+			return fmt.Errorf("%s: %w", description, err)
+		}
+		fmt.Printf("%s: %s\n", organization, description)
+	}
+
+	if !changed {
+		fmt.Println("Team sync mappings are up to date for", organization)
+	}
+	return nil
+}
+
+func sameIdPGroups(a []IdPGroupInfo, b []IdPGroupInfo) bool {
+	var aIDs, bIDs []string
+	for _, group := range a {
+		aIDs = append(aIDs, group.ID)
+	}
+	for _, group := range b {
+		bIDs = append(bIDs, group.ID)
+	}
+	toAdd, toRemove := diffStrings(aIDs, bIDs)
+	return len(toAdd) == 0 && len(toRemove) == 0
+}
+
+func idpGroupNames(groups []IdPGroupInfo) string {
+	var names []string
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// checkTeamMembershipEditable returns an error when the membership of the
+// team is managed by an identity provider. Commands that add or remove team
+// members must call it before changing anything.
+func checkTeamMembershipEditable(config *AccessConfig, slug string) error {
+	for _, team := range config.Teams {
+		if (strings.EqualFold(team.Slug, slug) || strings.EqualFold(team.Name, slug)) && team.IdPManaged {
+			return fmt.Errorf("the membership of team %s is managed by the identity provider groups %s", slug, idpGroupNames(team.IdPGroups))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyTeamSyncMappings(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	config := loadFixture(t, "acme.yaml")
+	groups := IdPGroupList{{ID: "9a8b7c", Name: "backend-devs"}}
+	findTeam(config, "backend").IdPGroups = groups
+	findTeam(config, "platform").IdPGroups = IdPGroupList{}
+	// Without idpGroups, the mapping of security is unknown.
+	findTeam(config, "security").IdPGroups = nil
+	findTeam(f.orgs["acme"], "security").IdPGroups = IdPGroupList{{ID: "5e6f", Name: "security"}}
+
+	if err := applyTeamSyncMappings(context.Background(), f.provider(), config, false); err != nil {
+		t.Fatal(err)
+	}
+
+	live := f.orgs["acme"]
+	if got := findTeam(live, "backend").IdPGroups; !reflect.DeepEqual(got, groups) {
+		t.Errorf("backend groups = %+v, want %+v", got, groups)
+	}
+	if got := findTeam(live, "platform").IdPGroups; len(got) != 0 {
+		t.Errorf("platform groups = %+v, want the mapping removed", got)
+	}
+	if got := findTeam(live, "security").IdPGroups; len(got) != 1 {
+		t.Errorf("security groups = %+v, want them left as they are", got)
+	}
+}
+
+func TestTeamSyncApplyLeavesMappingsTheExportCouldNotRead(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.forbidden = append(f.forbidden, "orgs/acme/team-sync/groups")
+
+	exported, _, err := exportWithFake(t, f, "acme", nil)
+	if err != nil {
+		t.Fatalf("exportOrganization: %v", err)
+	}
+	data, err := yaml.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "idpGroups") {
+		t.Errorf("unread mappings were written:\n%s", data)
+	}
+	var config AccessConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyTeamSyncMappings(context.Background(), f.provider(), &config, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := findTeam(f.orgs["acme"], "platform").IdPGroups; len(got) != 1 || got[0].ID != "1f2e3d" {
+		t.Errorf("platform groups = %+v, want the live mapping kept", got)
+	}
+	if n := f.count("PATCH orgs/acme/teams/platform/team-sync/group-mappings"); n != 0 {
+		t.Errorf("mapping of platform changed %d times", n)
+	}
+}
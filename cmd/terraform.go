@@ -0,0 +1,258 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// terraformPermissions maps the repository permissions to the ones of the
+// integrations/github provider.
+var terraformPermissions = map[string]string{
+	"READ":     "pull",
+	"TRIAGE":   "triage",
+	"WRITE":    "push",
+	"MAINTAIN": "maintain",
+	"ADMIN":    "admin",
+}
+
+// terraformPrivacy maps the GraphQL team privacy to the provider one.
+var terraformPrivacy = map[string]string{
+	"VISIBLE": "closed",
+	"SECRET":  "secret",
+}
+
+var invalidTerraformName = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// hclAttribute is a name = value line of a block. Value is HCL already.
+type hclAttribute struct {
+	name  string
+	value string
+}
+
+// terraformWriter renders resources and import blocks, giving each resource
+// a unique valid name.
+type terraformWriter struct {
+	b     strings.Builder
+	names map[string]bool
+}
+
+// resourceName returns a unique resource name of kind made of parts.
+func (w *terraformWriter) resourceName(kind string, parts ...string) string {
+	name := invalidTerraformName.ReplaceAllString(strings.ToLower(strings.Join(parts, "_")), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') || name[0] == '-' {
+		name = "_" + name
+	}
+	unique := name
+	for i := 2; w.names[kind+"."+unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	w.names[kind+"."+unique] = true
+	return unique
+}
+
+// block writes a block with its attributes aligned as terraform fmt does.
+func (w *terraformWriter) block(header string, attributes ...hclAttribute) {
+	width := 0
+	for _, attribute := range attributes {
+		if len(attribute.name) > width {
+			width = len(attribute.name)
+		}
+	}
+	fmt.Fprintf(&w.b, "%s {\n", header)
+	for _, attribute := range attributes {
+		fmt.Fprintf(&w.b, "  %-*s = %s\n", width, attribute.name, attribute.value)
+	}
+	w.b.WriteString("}\n\n")
+}
+
+// resource writes a resource and the import block that adopts it with id.
+func (w *terraformWriter) resource(kind string, name string, id string, attributes ...hclAttribute) {
+	w.block(fmt.Sprintf("resource %q %q", kind, name), attributes...)
+	w.block("import", hclAttribute{"to", kind + "." + name}, hclAttribute{"id", hclString(id)})
+}
+
+// renderTerraform returns config as Terraform configuration for the
+// integrations/github provider, with import blocks adopting every resource.
+// Team memberships of teams synchronized from an IdP are left out, as they
+// cannot be managed from GitHub.
+func renderTerraform(config *AccessConfig) string {
+	w := &terraformWriter{names: make(map[string]bool)}
+	organization := config.Organization.Login
+
+	fmt.Fprintf(&w.b, "# Access configuration of %s, generated by gh-aac.\n", organization)
+	w.b.WriteString("# Import blocks need Terraform 1.5 or later.\n\n")
+	w.b.WriteString("terraform {\n  required_providers {\n    github = {\n      source = \"integrations/github\"\n    }\n  }\n}\n\n")
+	w.block(`provider "github"`, hclAttribute{"owner", hclString(organization)})
+
+	for _, member := range config.Members {
+		role := "member"
+		if strings.EqualFold(member.Role, "ADMIN") {
+			role = "admin"
+		}
+		w.resource("github_membership", w.resourceName("github_membership", member.Login), organization+":"+member.Login,
+			hclAttribute{"username", hclString(member.Login)},
+			hclAttribute{"role", hclString(role)},
+		)
+	}
+
+	// Teams are referenced by the resource name of their github_team.
+	teamNames := make(map[string]string)
+	teamIDs := make(map[string]string)
+	for _, team := range config.Teams {
+		teamNames[strings.ToLower(team.Slug)] = w.resourceName("github_team", team.Slug)
+		// Teams exported before their IDs were are imported by slug, which
+		// the provider also accepts.
+		teamIDs[strings.ToLower(team.Slug)] = team.Slug
+		if team.DatabaseID > 0 {
+			teamIDs[strings.ToLower(team.Slug)] = strconv.FormatInt(team.DatabaseID, 10)
+		}
+	}
+	teamRef := func(slug string) (string, string, bool) {
+		team := findTeam(config, slug)
+		if team == nil {
+			return "", "", false
+		}
+		key := strings.ToLower(team.Slug)
+		return "github_team." + teamNames[key] + ".id", teamIDs[key], true
+	}
+
+	for _, team := range config.Teams {
+		attributes := []hclAttribute{{"name", hclString(team.Name)}}
+		if team.Description != "" {
+			attributes = append(attributes, hclAttribute{"description", hclString(team.Description)})
+		}
+		if privacy, ok := terraformPrivacy[strings.ToUpper(team.Privacy)]; ok {
+			attributes = append(attributes, hclAttribute{"privacy", hclString(privacy)})
+		}
+		for _, parent := range config.Teams {
+			if containsTeamName(config, parent.ChildTeams, team.Slug) {
+				ref, _, _ := teamRef(parent.Slug)
+				attributes = append(attributes, hclAttribute{"parent_team_id", ref})
+				break
+			}
+		}
+		w.resource("github_team", teamNames[strings.ToLower(team.Slug)], teamIDs[strings.ToLower(team.Slug)], attributes...)
+	}
+
+	for _, team := range config.Teams {
+		if team.IdPManaged {
+			fmt.Fprintf(&w.b, "# The members of %s are synchronized from the IdP.\n\n", team.Slug)
+			continue
+		}
+		ref, id, _ := teamRef(team.Slug)
+		for _, login := range team.Members {
+			role := "member"
+			if containsFold(team.Maintainers, login) {
+				role = "maintainer"
+			}
+			w.resource("github_team_membership", w.resourceName("github_team_membership", team.Slug, login), id+":"+login,
+				hclAttribute{"team_id", ref},
+				hclAttribute{"username", hclString(login)},
+				hclAttribute{"role", hclString(role)},
+			)
+		}
+	}
+
+	for _, permission := range config.Permissions.Teams {
+		ref, id, ok := teamRef(permission.Slug)
+		if !ok {
+			fmt.Fprintf(&w.b, "# Skipped the %s permission of the unknown team %s on %s.\n\n", permission.Access, permission.Slug, permission.Repo)
+			continue
+		}
+		w.resource("github_team_repository", w.resourceName("github_team_repository", permission.Slug, permission.Repo), id+":"+permission.Repo,
+			hclAttribute{"team_id", ref},
+			hclAttribute{"repository", hclString(permission.Repo)},
+			hclAttribute{"permission", hclString(terraformPermission(permission.Access))},
+		)
+	}
+
+	for _, permission := range config.Permissions.Users {
+		w.resource("github_repository_collaborator", w.resourceName("github_repository_collaborator", permission.Repo, permission.Login), permission.Repo+":"+permission.Login,
+			hclAttribute{"repository", hclString(permission.Repo)},
+			hclAttribute{"username", hclString(permission.Login)},
+			hclAttribute{"permission", hclString(terraformPermission(permission.Access))},
+		)
+	}
+
+	return strings.TrimSuffix(w.b.String(), "\n")
+}
+
+// terraformPermission returns the provider permission of access, which is
+// kept as is for custom repository roles.
+func terraformPermission(access string) string {
+	if permission, ok := terraformPermissions[strings.ToUpper(access)]; ok {
+		return permission
+	}
+	return access
+}
+
+// containsTeamName reports whether teams, slugs or names, contains the team slug.
+func containsTeamName(config *AccessConfig, teams []string, slug string) bool {
+	for _, team := range teams {
+		if sameTeam(config, team, slug) {
+			return true
+		}
+	}
+	return false
+}
+
+// hclString quotes value as an HCL string, escaping template sequences.
+func hclString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < ' ':
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(value[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func init() {
+	registerFormat(&aacFormat{
+		Name:        "terraform",
+		Aliases:     []string{"tf"},
+		Extensions:  []string{".tf"},
+		Description: "resources and import blocks for the integrations/github provider",
+		Encode:      accessConfigEncoder("terraform", renderTerraform),
+	})
+}
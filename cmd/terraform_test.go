@@ -0,0 +1,105 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTerraform(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	tf := renderTerraform(config)
+
+	for _, want := range []string{
+		"provider \"github\" {\n  owner = \"acme\"\n}\n",
+		"resource \"github_membership\" \"alice\" {\n  username = \"alice\"\n  role     = \"admin\"\n}\n\nimport {\n  to = github_membership.alice\n  id = \"acme:alice\"\n}\n",
+		"resource \"github_team\" \"backend\" {\n  name           = \"Backend\"\n  description    = \"Backend developers\"\n  privacy        = \"closed\"\n  parent_team_id = github_team.engineering.id\n}\n\nimport {\n  to = github_team.backend\n  id = \"101\"\n}\n",
+		"resource \"github_team\" \"security\" {\n  name    = \"Security\"\n  privacy = \"secret\"\n}\n",
+		"resource \"github_team_membership\" \"backend_bob\" {\n  team_id  = github_team.backend.id\n  username = \"bob\"\n  role     = \"member\"\n}\n\nimport {\n  to = github_team_membership.backend_bob\n  id = \"101:bob\"\n}\n",
+		"resource \"github_team_membership\" \"backend_carol\" {\n  team_id  = github_team.backend.id\n  username = \"carol\"\n  role     = \"maintainer\"\n}\n",
+		"resource \"github_team_membership\" \"engineering_alice\" {",
+		"# The members of platform are synchronized from the IdP.\n",
+		"resource \"github_team_repository\" \"backend_api\" {\n  team_id    = github_team.backend.id\n  repository = \"api\"\n  permission = \"maintain\"\n}\n\nimport {\n  to = github_team_repository.backend_api\n  id = \"101:api\"\n}\n",
+		"resource \"github_repository_collaborator\" \"tools_mallory\" {\n  repository = \"tools\"\n  username   = \"mallory\"\n  permission = \"admin\"\n}\n\nimport {\n  to = github_repository_collaborator.tools_mallory\n  id = \"tools:mallory\"\n}\n",
+	} {
+		if !strings.Contains(tf, want) {
+			t.Errorf("terraform does not contain:\n%s", want)
+		}
+	}
+
+	// Only immediate members are exported, and the ones of IdP-managed teams
+	// are left out.
+	for _, missing := range []string{"engineering_bob", "platform_erin"} {
+		if strings.Contains(tf, "\""+missing+"\"") {
+			t.Errorf("terraform has the membership %s", missing)
+		}
+	}
+	// dave is a member of engineering and of its child team frontend.
+	for _, both := range []string{"engineering_dave", "frontend_dave"} {
+		if !strings.Contains(tf, "resource \"github_team_membership\" \""+both+"\"") {
+			t.Errorf("terraform does not have the membership %s", both)
+		}
+	}
+}
+
+func TestRenderTerraformNames(t *testing.T) {
+	config := &AccessConfig{
+		Organization: OrganizationInfo{Login: "acme"},
+		Teams: []TeamInfo{
+			{Name: "2024 Interns", Slug: "2024-interns", Description: `Uses ${var} and "quotes"`},
+		},
+		Permissions: PermissionsInfo{Users: []UserPermission{
+			{Repo: "my.repo", Login: "bob", Access: "WRITE"},
+			{Repo: "my-repo", Login: "bob", Access: "READ"},
+			{Repo: "my_repo", Login: "bob", Access: "custom-role"},
+		}},
+	}
+	tf := renderTerraform(config)
+
+	for _, want := range []string{
+		"resource \"github_team\" \"_2024-interns\" {",
+		"id = \"2024-interns\"",
+		`description = "Uses $${var} and \"quotes\""`,
+		"resource \"github_repository_collaborator\" \"my_repo_bob\" {\n  repository = \"my.repo\"",
+		"resource \"github_repository_collaborator\" \"my-repo_bob\" {",
+		"resource \"github_repository_collaborator\" \"my_repo_bob_2\" {\n  repository = \"my_repo\"\n  username   = \"bob\"\n  permission = \"custom-role\"",
+	} {
+		if !strings.Contains(tf, want) {
+			t.Errorf("terraform does not contain %q:\n%s", want, tf)
+		}
+	}
+}
+
+func TestHCLString(t *testing.T) {
+	tests := map[string]string{
+		"plain":          `"plain"`,
+		"a\"b\\c\n":      `"a\"b\\c\n"`,
+		"${x} %{if} $ %": `"$${x} %%{if} $ %"`,
+		"tab\there\x01":  `"tab\there\u0001"`,
+	}
+	for value, want := range tests {
+		if got := hclString(value); got != want {
+			t.Errorf("hclString(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,477 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// terraformCmd represents the terraform command
+var terraformCmd = &cobra.Command{
+	Use:   "terraform",
+	Short: "Migrate access managed with Terraform into the access configuration",
+	Long: `Migrate access managed with Terraform into the access configuration.
+
+Use export --aac-format terraform to go the other way.
+
+Examples:
+  terraform show -json > state.json
+  gh-aac terraform import state.json --aac-path access-config.yaml`,
+}
+
+// terraformImportCmd represents the terraform import command
+var terraformImportCmd = &cobra.Command{
+	Use:   "import <state.json>",
+	Short: "Convert the GitHub resources of a Terraform state into the access configuration",
+	Long: `Convert the GitHub resources of a Terraform state into the access configuration.
+
+The state is the output of terraform show -json, or a terraform.tfstate file.
+These resources of the integrations/github provider are converted:
+
+  github_membership                members
+  github_team                      teams and child teams
+  github_team_membership           team members
+  github_team_members              team members
+  github_team_sync_group_mapping   IdP groups of the teams
+  github_team_repository           team permissions
+  github_repository_collaborator   user permissions
+  github_repository_collaborators  user and team permissions
+  github_repository                repositories
+
+Every other managed resource, and the ones referencing teams missing from the
+state, are reported as not mapped.
+The members, teams and permissions of the access configuration file are
+replaced with the ones of the state, and the rest of the file is kept.
+Without an access configuration file, a new one is written.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := viper.GetString("aac-path")
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", args[0], err)
+		}
+		resources, err := readTerraformState(data)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", args[0], err)
+		}
+		imported, unmapped := terraformStateConfig(resources)
+
+		config := &AccessConfig{}
+		if _, err := os.Stat(path); err == nil {
+			if config, err = LoadConfig(path); err != nil {
+				log.Fatalf("Failed to load config: %v", err)
+			}
+		}
+		if config.Organization.Login == "" {
+			if organization, err := targetOrganization(); err == nil {
+				config.Organization.Login = organization
+			} else {
+				config.Organization.Login = imported.Organization.Login
+			}
+		}
+		mergeTerraformState(config, imported)
+
+		data, err = marshalConfig(config, configFormat(path))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+
+		if len(unmapped) > 0 {
+			log.Printf("%d resources could not be mapped, or only in part:", len(unmapped))
+			for _, resource := range unmapped {
+				log.Printf("  %s: %s", resource.Address, resource.Reason)
+			}
+		}
+		log.Printf("Imported %d of %d resources of %s into %s", len(resources)-len(unmapped), len(resources), args[0], path)
+	},
+}
+
+// terraformResource is a managed resource instance of a Terraform state.
+type terraformResource struct {
+	Address string                 `json:"address"`
+	Mode    string                 `json:"mode"`
+	Type    string                 `json:"type"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+// unmappedResource is a resource of the state left out of the access
+// configuration.
+type unmappedResource struct {
+	Address string
+	Reason  string
+}
+
+// terraformModule is a module of the terraform show -json output.
+type terraformModule struct {
+	Resources    []terraformResource `json:"resources"`
+	ChildModules []terraformModule   `json:"child_modules"`
+}
+
+// terraformState holds both the terraform show -json output, with values,
+// and the terraform.tfstate file, with version and resources.
+type terraformState struct {
+	Values *struct {
+		RootModule terraformModule `json:"root_module"`
+	} `json:"values"`
+	Version   int `json:"version"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// readTerraformState returns the managed resources of a Terraform state,
+// either the output of terraform show -json or a terraform.tfstate file.
+func readTerraformState(data []byte) ([]terraformResource, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var state terraformState
+	if err := decoder.Decode(&state); err != nil {
+		return nil, err
+	}
+
+	var resources []terraformResource
+	switch {
+	case state.Values != nil:
+		var walk func(module terraformModule)
+		walk = func(module terraformModule) {
+			for _, resource := range module.Resources {
+				if resource.Mode == "managed" {
+					resources = append(resources, resource)
+				}
+			}
+			for _, child := range module.ChildModules {
+				walk(child)
+			}
+		}
+		walk(state.Values.RootModule)
+	case state.Version > 0:
+		for _, resource := range state.Resources {
+			if resource.Mode != "managed" {
+				continue
+			}
+			address := resource.Type + "." + resource.Name
+			if resource.Module != "" {
+				address = resource.Module + "." + address
+			}
+			for _, instance := range resource.Instances {
+				index := ""
+				switch key := instance.IndexKey.(type) {
+				case json.Number:
+					index = "[" + key.String() + "]"
+				case string:
+					index = "[" + strconv.Quote(key) + "]"
+				}
+				resources = append(resources, terraformResource{Address: address + index, Mode: resource.Mode, Type: resource.Type, Values: instance.Attributes})
+			}
+		}
+	default:
+		return nil, errors.New("not a Terraform state: run terraform show -json")
+	}
+	return resources, nil
+}
+
+// terraformAccess maps the permissions of the provider to the repository
+// permissions, the reverse of terraformPermissions.
+var terraformAccess = map[string]string{
+	"pull":     "READ",
+	"triage":   "TRIAGE",
+	"push":     "WRITE",
+	"maintain": "MAINTAIN",
+	"admin":    "ADMIN",
+}
+
+var invalidSlug = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// terraformStateConfig converts the GitHub resources into an access
+// configuration and returns the resources it could not map, or only in part,
+// once each with the first reason. The organization is the one of the
+// github_membership IDs.
+func terraformStateConfig(resources []terraformResource) (*AccessConfig, []unmappedResource) {
+	config := &AccessConfig{}
+	var unmapped []unmappedResource
+	reported := make(map[string]bool)
+	skip := func(resource terraformResource, format string, args ...interface{}) {
+		if reported[resource.Address] {
+			return
+		}
+		reported[resource.Address] = true
+		unmapped = append(unmapped, unmappedResource{Address: resource.Address, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	// Teams go first, as the other resources reference them by ID or slug.
+	teamIDs := make(map[string]string)
+	parents := make(map[string]string)
+	teamResources := make(map[string]terraformResource)
+	for _, resource := range resources {
+		if resource.Type != "github_team" {
+			continue
+		}
+		team := TeamInfo{
+			Name:        stateString(resource.Values, "name"),
+			Slug:        stateString(resource.Values, "slug"),
+			Description: stateString(resource.Values, "description"),
+		}
+		if team.Slug == "" {
+			team.Slug = strings.Trim(invalidSlug.ReplaceAllString(strings.ToLower(team.Name), "-"), "-")
+		}
+		if team.Name == "" || team.Slug == "" {
+			skip(resource, "team without a name")
+			continue
+		}
+		id := stateString(resource.Values, "id")
+		team.DatabaseID, _ = strconv.ParseInt(id, 10, 64)
+		for privacy, provider := range terraformPrivacy {
+			if stateString(resource.Values, "privacy") == provider {
+				team.Privacy = privacy
+			}
+		}
+		teamIDs[id] = team.Slug
+		teamResources[team.Slug] = resource
+		if parent := stateString(resource.Values, "parent_team_id"); parent != "" {
+			parents[team.Slug] = parent
+		}
+		config.Teams = append(config.Teams, team)
+	}
+	for _, team := range config.Teams {
+		if parent, ok := parents[team.Slug]; ok {
+			if slug, ok := teamIDs[parent]; ok {
+				parent = slug
+			}
+			if parentTeam := findTeam(config, parent); parentTeam != nil {
+				parentTeam.ChildTeams = append(parentTeam.ChildTeams, team.Slug)
+			} else {
+				skip(teamResources[team.Slug], "parent team %s is not in the state, imported without it", parent)
+			}
+		}
+	}
+	// resolveTeam returns the team of a team_id, which is an ID or a slug.
+	resolveTeam := func(id string) *TeamInfo {
+		if slug, ok := teamIDs[id]; ok {
+			id = slug
+		}
+		return findTeam(config, id)
+	}
+	// Team synchronization goes before the memberships, which are not
+	// imported for the teams whose membership comes from the IdP.
+	for _, resource := range resources {
+		if resource.Type != "github_team_sync_group_mapping" {
+			continue
+		}
+		team := resolveTeam(stateString(resource.Values, "team_slug"))
+		if team == nil {
+			skip(resource, "team %s is not in the state", stateString(resource.Values, "team_slug"))
+			continue
+		}
+		team.IdPManaged = true
+		for _, group := range stateList(resource.Values, "group") {
+			team.IdPGroups = append(team.IdPGroups, IdPGroupInfo{
+				ID:          stateString(group, "group_id"),
+				Name:        stateString(group, "group_name"),
+				Description: stateString(group, "group_description"),
+			})
+		}
+	}
+	addMember := func(resource terraformResource, teamID string, login string, role string) {
+		team := resolveTeam(teamID)
+		if team == nil {
+			skip(resource, "team %s is not in the state", teamID)
+			return
+		}
+		if err := checkTeamMembershipEditable(config, team.Slug); err != nil {
+			skip(resource, "%v", err)
+			return
+		}
+		if !containsFold(team.Members, login) {
+			team.Members = append(team.Members, login)
+		}
+		if strings.EqualFold(role, "maintainer") && !containsFold(team.Maintainers, login) {
+			team.Maintainers = append(team.Maintainers, login)
+		}
+	}
+	addTeamPermission := func(resource terraformResource, teamID string, repo string, permission string) {
+		team := resolveTeam(teamID)
+		if team == nil {
+			skip(resource, "team %s is not in the state", teamID)
+			return
+		}
+		config.Permissions.Teams = append(config.Permissions.Teams, TeamPermission{Repo: repo, Slug: team.Slug, Access: stateAccess(permission, "pull")})
+	}
+
+	for _, resource := range resources {
+		values := resource.Values
+		switch resource.Type {
+		case "github_team":
+		case "github_membership":
+			login := stateString(values, "username")
+			if organization, _, ok := strings.Cut(stateString(values, "id"), ":"); ok && config.Organization.Login == "" {
+				config.Organization.Login = organization
+			}
+			config.Members = append(config.Members, MemberInfo{Login: login, Role: strings.ToUpper(stateStringOr(values, "role", "member"))})
+		case "github_team_membership":
+			addMember(resource, stateString(values, "team_id"), stateString(values, "username"), stateString(values, "role"))
+		case "github_team_members":
+			for _, member := range stateList(values, "members") {
+				addMember(resource, stateString(values, "team_id"), stateString(member, "username"), stateString(member, "role"))
+			}
+		case "github_team_sync_group_mapping":
+		case "github_team_repository":
+			addTeamPermission(resource, stateString(values, "team_id"), stateString(values, "repository"), stateString(values, "permission"))
+		case "github_repository_collaborator":
+			config.Permissions.Users = append(config.Permissions.Users, UserPermission{
+				Repo:   stateString(values, "repository"),
+				Login:  stateString(values, "username"),
+				Access: stateAccess(stateString(values, "permission"), "push"),
+			})
+		case "github_repository_collaborators":
+			repo := stateString(values, "repository")
+			for _, user := range stateList(values, "user") {
+				config.Permissions.Users = append(config.Permissions.Users, UserPermission{
+					Repo:   repo,
+					Login:  stateString(user, "username"),
+					Access: stateAccess(stateString(user, "permission"), "push"),
+				})
+			}
+			for _, team := range stateList(values, "team") {
+				addTeamPermission(resource, stateString(team, "team_id"), repo, stateString(team, "permission"))
+			}
+		case "github_repository":
+			config.Repositories = append(config.Repositories, RepositoryInfo{Name: stateString(values, "name"), URL: stateString(values, "html_url")})
+		default:
+			skip(resource, "%s is not an access resource", resource.Type)
+		}
+	}
+	return config, unmapped
+}
+
+// mergeTerraformState replaces the members, teams and permissions of config
+// with the imported ones. The IDs, privacy and IdP groups of the teams that
+// the state lacks are kept from config, and the imported repositories are
+// added to the ones of config.
+func mergeTerraformState(config *AccessConfig, imported *AccessConfig) {
+	for i := range imported.Teams {
+		team := &imported.Teams[i]
+		previous := findTeam(config, team.Slug)
+		if previous == nil {
+			continue
+		}
+		if team.DatabaseID == 0 {
+			team.DatabaseID = previous.DatabaseID
+		}
+		if team.Privacy == "" {
+			team.Privacy = previous.Privacy
+		}
+		if len(team.IdPGroups) == 0 {
+			team.IdPManaged = previous.IdPManaged
+			team.IdPGroups = previous.IdPGroups
+		}
+		// The membership of IdP-managed teams comes from the identity
+		// provider, not from the state.
+		if checkTeamMembershipEditable(config, team.Slug) != nil {
+			team.Members = previous.Members
+			team.Maintainers = previous.Maintainers
+		}
+	}
+	known := make(map[string]bool)
+	for _, repository := range config.Repositories {
+		known[strings.ToLower(repository.Name)] = true
+	}
+	for _, repository := range imported.Repositories {
+		if !known[strings.ToLower(repository.Name)] {
+			config.Repositories = append(config.Repositories, repository)
+		}
+	}
+	config.Members = imported.Members
+	config.Teams = imported.Teams
+	config.Permissions = imported.Permissions
+}
+
+// stateString returns the attribute key of values as a string.
+func stateString(values map[string]interface{}, key string) string {
+	switch value := values[key].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
+
+// stateStringOr returns the attribute key of values, or fallback when empty.
+func stateStringOr(values map[string]interface{}, key string, fallback string) string {
+	if value := stateString(values, key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// stateList returns the nested blocks of the attribute key of values.
+func stateList(values map[string]interface{}, key string) []map[string]interface{} {
+	list, _ := values[key].([]interface{})
+	var blocks []map[string]interface{}
+	for _, item := range list {
+		if block, ok := item.(map[string]interface{}); ok {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// stateAccess returns the repository permission of a provider permission,
+// which is kept as is for custom repository roles.
+func stateAccess(permission string, fallback string) string {
+	if permission == "" {
+		permission = fallback
+	}
+	if access, ok := terraformAccess[permission]; ok {
+		return access
+	}
+	return permission
+}
+
+func init() {
+	rootCmd.AddCommand(terraformCmd)
+	terraformCmd.AddCommand(terraformImportCmd)
+}
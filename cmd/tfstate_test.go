@@ -0,0 +1,152 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func readStateFixture(t *testing.T) []terraformResource {
+	t.Helper()
+	data, err := os.ReadFile("testdata/terraform-show.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := readTerraformState(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resources
+}
+
+func TestTerraformStateConfig(t *testing.T) {
+	resources := readStateFixture(t)
+	// The data source is left out.
+	if len(resources) != 16 {
+		t.Fatalf("got %d resources, want 16", len(resources))
+	}
+	config, unmapped := terraformStateConfig(resources)
+
+	if config.Organization.Login != "acme" {
+		t.Errorf("organization = %q, want acme", config.Organization.Login)
+	}
+	wantMembers := []MemberInfo{{Login: "alice", Role: "ADMIN"}, {Login: "bob", Role: "MEMBER"}}
+	if !reflect.DeepEqual(config.Members, wantMembers) {
+		t.Errorf("members = %+v, want %+v", config.Members, wantMembers)
+	}
+
+	wantTeams := []TeamInfo{
+		{Name: "Engineering", Slug: "engineering", DatabaseID: 100, Privacy: "VISIBLE", ChildTeams: []string{"backend"}},
+		{Name: "Backend", Slug: "backend", DatabaseID: 101, Privacy: "VISIBLE", Description: "Backend developers", Members: []string{"bob"}, Maintainers: []string{"bob"}},
+		{Name: "Security", Slug: "security", DatabaseID: 104, Privacy: "SECRET",
+			IdPManaged: true, IdPGroups: []IdPGroupInfo{{ID: "g-1", Name: "Security", Description: "Security team"}}},
+		{Name: "Orphan", Slug: "orphan", DatabaseID: 105, Privacy: "VISIBLE"},
+	}
+	if !reflect.DeepEqual(config.Teams, wantTeams) {
+		t.Errorf("teams = %+v, want %+v", config.Teams, wantTeams)
+	}
+
+	wantPermissions := PermissionsInfo{
+		Teams: []TeamPermission{{Repo: "api", Slug: "backend", Access: "MAINTAIN"}, {Repo: "infra", Slug: "security", Access: "WRITE"}},
+		Users: []UserPermission{{Repo: "tools", Login: "mallory", Access: "ADMIN"}, {Repo: "infra", Login: "erin", Access: "TRIAGE"}},
+	}
+	if !reflect.DeepEqual(config.Permissions, wantPermissions) {
+		t.Errorf("permissions = %+v, want %+v", config.Permissions, wantPermissions)
+	}
+	if want := []RepositoryInfo{{Name: "api", URL: "https://github.com/acme/api"}}; !reflect.DeepEqual(config.Repositories, want) {
+		t.Errorf("repositories = %+v, want %+v", config.Repositories, want)
+	}
+
+	wantUnmapped := []unmappedResource{
+		{Address: "github_team.orphan", Reason: "parent team 997 is not in the state, imported without it"},
+		{Address: "github_team_membership.lost", Reason: "team 999 is not in the state"},
+		{Address: "github_team_members.ghost", Reason: "team 998 is not in the state"},
+		{Address: "github_branch_protection.api_main", Reason: "github_branch_protection is not an access resource"},
+		{Address: "module.security.github_team_members.security", Reason: "the membership of team security is managed by the identity provider groups Security"},
+	}
+	if !reflect.DeepEqual(unmapped, wantUnmapped) {
+		t.Errorf("unmapped = %+v, want %+v", unmapped, wantUnmapped)
+	}
+}
+
+func TestReadTerraformStateFile(t *testing.T) {
+	state := `{
+  "version": 4,
+  "resources": [
+    {"mode": "managed", "type": "github_membership", "name": "members", "instances": [
+      {"index_key": "alice", "attributes": {"id": "acme:alice", "username": "alice", "role": "admin"}},
+      {"index_key": "bob", "attributes": {"id": "acme:bob", "username": "bob", "role": "member"}}
+    ]},
+    {"module": "module.repos", "mode": "managed", "type": "github_repository_collaborator", "name": "outside", "instances": [
+      {"index_key": 0, "attributes": {"repository": "tools", "username": "mallory", "permission": ""}}
+    ]},
+    {"mode": "data", "type": "github_team", "name": "all", "instances": [{"attributes": {"slug": "all"}}]}
+  ]
+}`
+	resources, err := readTerraformState([]byte(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for _, resource := range resources {
+		addresses = append(addresses, resource.Address)
+	}
+	want := []string{`github_membership.members["alice"]`, `github_membership.members["bob"]`, "module.repos.github_repository_collaborator.outside[0]"}
+	if !reflect.DeepEqual(addresses, want) {
+		t.Errorf("addresses = %q, want %q", addresses, want)
+	}
+
+	config, _ := terraformStateConfig(resources)
+	// The provider grants push by default.
+	if want := []UserPermission{{Repo: "tools", Login: "mallory", Access: "WRITE"}}; !reflect.DeepEqual(config.Permissions.Users, want) {
+		t.Errorf("user permissions = %+v, want %+v", config.Permissions.Users, want)
+	}
+
+	if _, err := readTerraformState([]byte(`{"format_version": "1.0"}`)); err == nil {
+		t.Error("expected an error for a plan without values")
+	}
+}
+
+func TestTerraformStateRoundTrip(t *testing.T) {
+	fixture := loadFixture(t, "acme.yaml")
+	config, _ := terraformStateConfig(readStateFixture(t))
+	mergeTerraformState(fixture, config)
+
+	if len(fixture.Environments) != 2 || fixture.Organization.DefaultRepositoryPermission != "READ" {
+		t.Error("sections not managed by Terraform were dropped")
+	}
+	if !reflect.DeepEqual(fixture.Members, config.Members) || !reflect.DeepEqual(fixture.Permissions, config.Permissions) {
+		t.Error("members and permissions were not replaced")
+	}
+	// api was already in the fixture.
+	count := 0
+	for _, repository := range fixture.Repositories {
+		if repository.Name == "api" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("api is listed %d times", count)
+	}
+}
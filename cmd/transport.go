@@ -0,0 +1,340 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxRetries is used when max-retries is not configured.
+	defaultMaxRetries = 5
+	// secondaryRateLimitWait is how long to wait after a secondary rate limit
+	// response without Retry-After, as recommended by GitHub.
+	secondaryRateLimitWait = time.Minute
+	maxBackoff             = 30 * time.Second
+)
+
+// rateLimits is the budget observed during the run, shared by every client.
+var rateLimits = &rateLimitState{resources: make(map[string]*rateLimitBudget)}
+
+// rateLimitBudget is the rate limit of one API resource (core, graphql, search...).
+type rateLimitBudget struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	// Cost is the sum of the GraphQL rateLimit.cost of the queries of the run.
+	Cost int
+}
+
+type rateLimitState struct {
+	mu        sync.Mutex
+	resources map[string]*rateLimitBudget
+}
+
+func (s *rateLimitState) budget(resource string) *rateLimitBudget {
+	b, ok := s.resources[resource]
+	if !ok {
+		b = &rateLimitBudget{Remaining: -1}
+		s.resources[resource] = b
+	}
+	return b
+}
+
+// update records the rate limit headers of a response.
+func (s *rateLimitState) update(resource string, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	if r := header.Get("X-RateLimit-Resource"); r != "" {
+		resource = r
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.budget(resource)
+	b.Remaining = remaining
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		b.Limit = limit
+	}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		b.Reset = time.Unix(reset, 0)
+	}
+}
+
+// updateGraphQL records the rateLimit object returned along with a GraphQL query.
+func (s *rateLimitState) updateGraphQL(cost int, remaining int, resetAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.budget("graphql")
+	b.Cost += cost
+	b.Remaining = remaining
+	if !resetAt.IsZero() {
+		b.Reset = resetAt
+	}
+}
+
+// exhaustedUntil returns when the budget of resource resets if it is exhausted.
+func (s *rateLimitState) exhaustedUntil(resource string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.resources[resource]
+	if !ok || b.Remaining != 0 || time.Now().After(b.Reset) {
+		return time.Time{}, false
+	}
+	return b.Reset, true
+}
+
+// reportRateLimits logs the remaining budget of every resource used in the run.
+func reportRateLimits() {
+	rateLimits.mu.Lock()
+	defer rateLimits.mu.Unlock()
+
+	var names []string
+	for name := range rateLimits.resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b := rateLimits.resources[name]
+		if b.Remaining < 0 {
+			continue
+		}
+		cost := ""
+		if b.Cost > 0 {
+			cost = fmt.Sprintf(", %d points used by this run", b.Cost)
+		}
+		log.Printf("Rate limit %s: %d/%d remaining, resets at %s%s\n", name, b.Remaining, b.Limit, b.Reset.Local().Format(time.RFC3339), cost)
+	}
+}
+
+// rateLimitTransport retries transient failures and waits out primary and
+// secondary rate limits before giving up on a request.
+type rateLimitTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	state      *rateLimitState
+	// sleep waits before a retry, returning early when req is cancelled.
+	sleep func(req *http.Request, d time.Duration) error
+}
+
+func newRateLimitTransport(base http.RoundTripper, maxRetries int) *rateLimitTransport {
+	if base == nil {
+		base = baseTransport
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if maxRetries < 0 {
+		maxRetries = defaultMaxRetries
+	}
+	return &rateLimitTransport{base: base, maxRetries: maxRetries, state: rateLimits, sleep: sleepContext}
+}
+
+// resourceOf guesses the rate limit resource of a request before it is sent.
+func resourceOf(req *http.Request) string {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/graphql"):
+		return "graphql"
+	case strings.Contains(req.URL.Path, "/search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := resourceOf(req)
+
+	for attempt := 0; ; attempt++ {
+		if reset, exhausted := t.state.exhaustedUntil(resource); exhausted {
+			log.Printf("Rate limit %s exhausted, waiting until %s\n", resource, reset.Local().Format(time.RFC3339))
+			if err := t.sleep(req, time.Until(reset)+time.Second); err != nil {
+				return nil, err
+			}
+		}
+
+		attemptReq := req
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("cannot retry a request without GetBody")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err != nil {
+			if attempt >= t.maxRetries || !isTransientError(err) || req.Context().Err() != nil {
+				return nil, err
+			}
+			wait := backoff(attempt)
+			log.Printf("Request to %s failed (%v), retrying in %s\n", req.URL.Path, err, wait)
+			if err := t.sleep(req, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		t.state.update(resource, resp.Header)
+
+		wait, retry, err := t.retryAfter(resource, resp, attempt)
+		if err != nil {
+			return nil, err
+		}
+		if !retry || attempt >= t.maxRetries {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		log.Printf("Request to %s got %s, retrying in %s\n", req.URL.Path, resp.Status, wait.Round(time.Second))
+		if err := t.sleep(req, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter decides whether resp must be retried and how long to wait first.
+// The body of resp is buffered so it can still be read by the caller.
+func (t *rateLimitTransport) retryAfter(resource string, resp *http.Response, attempt int) (time.Duration, bool, error) {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return 0, false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	retryAfter := time.Duration(0)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	untilReset := func() time.Duration {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			if wait := time.Until(time.Unix(reset, 0)) + time.Second; wait > 0 {
+				return wait
+			}
+		}
+		return backoff(attempt)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		if retryAfter > 0 {
+			return retryAfter, true, nil
+		}
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return untilReset(), true, nil
+		}
+		body := strings.ToLower(string(data))
+		if strings.Contains(body, "secondary rate limit") || strings.Contains(body, "abuse") {
+			return secondaryRateLimitWait, true, nil
+		}
+		return 0, false, nil
+	case resp.StatusCode >= 500:
+		if retryAfter > 0 {
+			return retryAfter, true, nil
+		}
+		return backoff(attempt), true, nil
+	case resource == "graphql" && resp.StatusCode == http.StatusOK:
+		var body struct {
+			Data struct {
+				RateLimit *struct {
+					Cost      int       `json:"cost"`
+					Remaining int       `json:"remaining"`
+					ResetAt   time.Time `json:"resetAt"`
+				} `json:"rateLimit"`
+			} `json:"data"`
+			Errors []struct {
+				Type string `json:"type"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(data, &body) != nil {
+			return 0, false, nil
+		}
+		if rl := body.Data.RateLimit; rl != nil {
+			t.state.updateGraphQL(rl.Cost, rl.Remaining, rl.ResetAt)
+		}
+		for _, e := range body.Errors {
+			if e.Type == "RATE_LIMITED" {
+				return untilReset(), true, nil
+			}
+		}
+	}
+
+	return 0, false, nil
+}
+
+// isTransientError reports whether a transport error is worth retrying.
+func isTransientError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		strings.Contains(err.Error(), "connection reset") || strings.Contains(err.Error(), "connection refused")
+}
+
+// backoff returns an exponential delay with jitter for the given attempt.
+func backoff(attempt int) time.Duration {
+	wait := time.Second << uint(attempt)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func sleepContext(req *http.Request, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
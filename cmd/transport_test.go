@@ -0,0 +1,286 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// retryServer answers the requests of a test with the responses of handlers
+// in turn, repeating the last one, and records the request bodies.
+type retryServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	handlers []http.HandlerFunc
+	bodies   []string
+}
+
+func newRetryServer(t *testing.T, handlers ...http.HandlerFunc) *retryServer {
+	t.Helper()
+	s := &retryServer{handlers: handlers}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		i := len(s.bodies)
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+		if i >= len(s.handlers) {
+			i = len(s.handlers) - 1
+		}
+		s.handlers[i](w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *retryServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+// respond returns a handler writing status, headers and body.
+func respond(status int, body string, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}
+}
+
+// testTransport returns a transport with its own rate limit state that
+// records its waits instead of sleeping.
+func testTransport(base http.RoundTripper, maxRetries int) (*rateLimitTransport, *[]time.Duration) {
+	var waits []time.Duration
+	t := &rateLimitTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		state:      &rateLimitState{resources: make(map[string]*rateLimitBudget)},
+		sleep: func(req *http.Request, d time.Duration) error {
+			waits = append(waits, d)
+			return req.Context().Err()
+		},
+	}
+	return t, &waits
+}
+
+func getThrough(t *testing.T, transport http.RoundTripper, url string) *http.Response {
+	t.Helper()
+	resp, err := (&http.Client{Transport: transport}).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestRateLimitTransportBacksOffServerErrors(t *testing.T) {
+	server := newRetryServer(t,
+		respond(http.StatusBadGateway, "bad gateway"),
+		respond(http.StatusServiceUnavailable, "unavailable"),
+		respond(http.StatusOK, "done"),
+	)
+	transport, waits := testTransport(http.DefaultTransport, 5)
+
+	resp := getThrough(t, transport, server.URL+"/orgs/acme")
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "done" {
+		t.Errorf("response = %d %q, want 200 done", resp.StatusCode, body)
+	}
+	if server.requests() != 3 || len(*waits) != 2 {
+		t.Fatalf("requests = %d, waits = %v, want 3 requests and 2 waits", server.requests(), *waits)
+	}
+	// Exponential backoff with jitter: 1s then 2s, each halved at most.
+	for i, wait := range *waits {
+		max := time.Second << uint(i)
+		if wait < max/2 || wait > max {
+			t.Errorf("wait %d = %s, want between %s and %s", i, wait, max/2, max)
+		}
+	}
+}
+
+func TestRateLimitTransportRetryCap(t *testing.T) {
+	server := newRetryServer(t, respond(http.StatusInternalServerError, "boom"))
+	transport, waits := testTransport(http.DefaultTransport, 2)
+
+	resp := getThrough(t, transport, server.URL+"/orgs/acme")
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusInternalServerError || string(body) != "boom" {
+		t.Errorf("response = %d %q, want the last 500", resp.StatusCode, body)
+	}
+	if server.requests() != 3 || len(*waits) != 2 {
+		t.Errorf("requests = %d, waits = %v, want 3 requests and 2 waits", server.requests(), *waits)
+	}
+}
+
+func TestRateLimitTransportRetryAfter(t *testing.T) {
+	server := newRetryServer(t,
+		respond(http.StatusTooManyRequests, "slow down", "Retry-After", "7"),
+		respond(http.StatusOK, "{}"),
+	)
+	transport, waits := testTransport(http.DefaultTransport, 5)
+
+	if resp := getThrough(t, transport, server.URL+"/orgs/acme"); resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if len(*waits) != 1 || (*waits)[0] != 7*time.Second {
+		t.Errorf("waits = %v, want [7s]", *waits)
+	}
+}
+
+func TestRateLimitTransportSecondaryRateLimit(t *testing.T) {
+	server := newRetryServer(t,
+		respond(http.StatusForbidden, `{"message": "You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`),
+		respond(http.StatusOK, "{}"),
+	)
+	transport, waits := testTransport(http.DefaultTransport, 5)
+
+	if resp := getThrough(t, transport, server.URL+"/orgs/acme"); resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if len(*waits) != 1 || (*waits)[0] != secondaryRateLimitWait {
+		t.Errorf("waits = %v, want [%s]", *waits, secondaryRateLimitWait)
+	}
+}
+
+func TestRateLimitTransportPrimaryRateLimit(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(10*time.Second).Unix(), 10)
+	server := newRetryServer(t,
+		respond(http.StatusForbidden, `{"message": "API rate limit exceeded"}`,
+			"X-RateLimit-Limit", "5000", "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", reset),
+		respond(http.StatusOK, "{}", "X-RateLimit-Limit", "5000", "X-RateLimit-Remaining", "4999", "X-RateLimit-Reset", reset),
+	)
+	transport, waits := testTransport(http.DefaultTransport, 5)
+
+	if resp := getThrough(t, transport, server.URL+"/orgs/acme"); resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	// The retry waits until the reset, and so does the next request while
+	// the recorded budget is exhausted.
+	if len(*waits) == 0 || (*waits)[0] < 9*time.Second || (*waits)[0] > 12*time.Second {
+		t.Errorf("waits = %v, want the first one until the reset", *waits)
+	}
+	if b := transport.state.resources["core"]; b == nil || b.Remaining != 4999 || b.Limit != 5000 {
+		t.Errorf("core budget = %+v, want 4999/5000", b)
+	}
+}
+
+func TestRateLimitTransportDoesNotRetryForbidden(t *testing.T) {
+	server := newRetryServer(t, respond(http.StatusForbidden, `{"message": "Must have admin rights to Repository."}`))
+	transport, waits := testTransport(http.DefaultTransport, 5)
+
+	if resp := getThrough(t, transport, server.URL+"/repos/acme/api/hooks"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", resp.StatusCode)
+	}
+	if server.requests() != 1 || len(*waits) != 0 {
+		t.Errorf("requests = %d, waits = %v, want a single request", server.requests(), *waits)
+	}
+}
+
+func TestRateLimitTransportGraphQLRateLimited(t *testing.T) {
+	server := newRetryServer(t,
+		respond(http.StatusOK, `{"errors": [{"type": "RATE_LIMITED", "message": "API rate limit exceeded"}]}`),
+		respond(http.StatusOK, `{"data": {"rateLimit": {"cost": 3, "remaining": 4990, "resetAt": "2030-01-01T00:00:00Z"}}}`),
+	)
+	transport, waits := testTransport(http.DefaultTransport, 5)
+
+	query := `{"query": "query { rateLimit { cost } }"}`
+	resp, err := (&http.Client{Transport: transport}).Post(server.URL+"/graphql", "application/json", strings.NewReader(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(*waits) != 1 || server.requests() != 2 {
+		t.Errorf("requests = %d, waits = %v, want one retry", server.requests(), *waits)
+	}
+	// The body is sent again on the retry.
+	for i, body := range server.bodies {
+		if body != query {
+			t.Errorf("body %d = %q, want the query", i, body)
+		}
+	}
+	if b := transport.state.resources["graphql"]; b == nil || b.Cost != 3 || b.Remaining != 4990 {
+		t.Errorf("graphql budget = %+v, want cost 3 and 4990 remaining", b)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimitTransportRetriesTransientErrors(t *testing.T) {
+	attempts := 0
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("ok")), Request: req}, nil
+	})
+	transport, waits := testTransport(base, 5)
+
+	if resp := getThrough(t, transport, "https://api.github.com/orgs/acme"); resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if attempts != 3 || len(*waits) != 2 {
+		t.Errorf("attempts = %d, waits = %v, want 3 attempts", attempts, *waits)
+	}
+
+	attempts = 0
+	permanent := errors.New("x509: certificate signed by unknown authority")
+	transport, _ = testTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, permanent
+	}), 5)
+	if _, err := (&http.Client{Transport: transport}).Get("https://api.github.com/orgs/acme"); !errors.Is(err, permanent) || attempts != 1 {
+		t.Errorf("err = %v after %d attempts, want the error without retries", err, attempts)
+	}
+}
+
+func TestRateLimitTransportStopsWhenCancelled(t *testing.T) {
+	server := newRetryServer(t, respond(http.StatusServiceUnavailable, "unavailable"))
+	transport := newRateLimitTransport(http.DefaultTransport, 5)
+	transport.state = &rateLimitState{resources: make(map[string]*rateLimitBudget)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/orgs/acme", nil)
+	start := time.Now()
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the retry kept waiting for %s after the deadline", elapsed)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// webhooksCmd represents the webhooks command
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Inspect the webhooks of the access configuration",
+}
+
+// webhooksCheckCmd represents the webhooks check command
+var webhooksCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Flag webhooks delivering to domains outside the allowlist",
+	Long: `Flag webhooks delivering to domains outside the allowlist.
+
+The allowlist is read from the config file:
+
+  webhooks:
+    allowed-domains:
+      - example.com
+      - "*.example.org"
+
+A domain also allows all of its subdomains.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+
+		violations := checkWebhooks(config, viper.GetStringSlice("webhooks.allowed-domains"))
+		for _, hook := range violations {
+			scope := config.Organization.Login
+			if hook.Repo != "" {
+				scope = scope + "/" + hook.Repo
+			}
+			fmt.Printf("%s: webhook to %s is not allowed (events: %s)\n", scope, hook.Host, strings.Join(hook.Events, ", "))
+		}
+
+		if len(violations) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("All webhooks deliver to allowed domains")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(webhooksCmd)
+	webhooksCmd.AddCommand(webhooksCheckCmd)
+}
+
+// restWebhook is the REST representation of an organization or repository hook.
+type restWebhook struct {
+	Active bool     `json:"active"`
+	Events []string `json:"events"`
+	Config struct {
+		URL         string      `json:"url"`
+		ContentType string      `json:"content_type"`
+		InsecureSSL interface{} `json:"insecure_ssl"`
+	} `json:"config"`
+}
+
+// redactedHost is exported instead of the host of a delivery URL that cannot
+// be parsed, as the raw URL may carry secrets in its path or query.
+const redactedHost = "redacted"
+
+func (h restWebhook) toWebhookInfo(repo string) WebhookInfo {
+	host := redactedHost
+	if parsed, err := url.Parse(h.Config.URL); err == nil && parsed.Host != "" {
+		host = parsed.Hostname()
+	}
+
+	return WebhookInfo{
+		Repo:        repo,
+		Host:        host,
+		Events:      h.Events,
+		Active:      h.Active,
+		ContentType: h.Config.ContentType,
+		SSLVerify:   fmt.Sprint(h.Config.InsecureSSL) != "1",
+	}
+}
+
+// getRESTWebhooks lists the hooks of a REST hooks endpoint.
+func getRESTWebhooks(ctx context.Context, client *http.Client, path string, repo string) ([]WebhookInfo, error) {
+	hooks, err := restGetAll[restWebhook](ctx, client, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []WebhookInfo
+	for _, hook := range hooks {
+		webhooks = append(webhooks, hook.toWebhookInfo(repo))
+	}
+	return webhooks, nil
+}
+
+func getWebhooks(ctx context.Context, pool *workerPool, provider Provider, organization string, repos []RepositoryInfo) (WebhooksInfo, error) {
+	var webhooks WebhooksInfo
+	repoWebhooks := make([][]WebhookInfo, len(repos))
+
+	g := newTaskGroup(pool)
+
+	g.Go(func() error {
+		orgHooks, err := provider.OrganizationWebhooks(ctx, organization)
+		if err != nil {
+			if !skipUnavailable(err, "the admin:org_hook scope") {
+				return err
+			}
+			log.Printf("Skipping organization webhooks for %s: %v\n", organization, err)
+		}
+		webhooks.Organization = orgHooks
+		return nil
+	})
+
+	for i, repo := range repos {
+		i, repo := i, repo
+		g.Go(func() error {
+			repoHooks, err := provider.RepoWebhooks(ctx, organization, repo.Name)
+			if err != nil {
+				if !skipUnavailable(err, "the read:repo_hook scope and admin access to the repository") {
+					return err
+				}
+				log.Printf("Skipping webhooks for %s/%s: %v\n", organization, repo.Name, err)
+				return nil
+			}
+			repoWebhooks[i] = repoHooks
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return WebhooksInfo{}, err
+	}
+
+	for _, hooks := range repoWebhooks {
+		webhooks.Repositories = append(webhooks.Repositories, hooks...)
+	}
+	return webhooks, nil
+}
+
+// checkWebhooks returns the webhooks whose host is not covered by allowedDomains.
+func checkWebhooks(config *AccessConfig, allowedDomains []string) []WebhookInfo {
+	var violations []WebhookInfo
+
+	hooks := append([]WebhookInfo{}, config.Webhooks.Organization...)
+	hooks = append(hooks, config.Webhooks.Repositories...)
+
+	for _, hook := range hooks {
+		if !isAllowedDomain(hook.Host, allowedDomains) {
+			violations = append(violations, hook)
+		}
+	}
+
+	return violations
+}
+
+func isAllowedDomain(host string, allowedDomains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range allowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "*."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
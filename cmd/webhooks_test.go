@@ -0,0 +1,51 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import "testing"
+
+func TestToWebhookInfo(t *testing.T) {
+	tests := map[string]string{
+		"https://hooks.example.com/services/T000/B000/secret?token=x": "hooks.example.com",
+		"http://10.0.0.1:8080/hook":                                   "10.0.0.1",
+		"hooks.example.com/secret":                                    redactedHost,
+		"https://%zz.example.com/secret":                              redactedHost,
+	}
+	for rawURL, want := range tests {
+		var hook restWebhook
+		hook.Config.URL = rawURL
+		if got := hook.toWebhookInfo("api").Host; got != want {
+			t.Errorf("host of %q = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestCheckWebhooks(t *testing.T) {
+	config := &AccessConfig{Webhooks: WebhooksInfo{
+		Organization: []WebhookInfo{{Host: "ci.example.com"}, {Host: redactedHost}},
+		Repositories: []WebhookInfo{{Repo: "api", Host: "EXAMPLE.org"}, {Repo: "web", Host: "evil-example.com"}},
+	}}
+	violations := checkWebhooks(config, []string{"example.com", "*.example.org"})
+	if len(violations) != 2 || violations[0].Host != redactedHost || violations[1].Host != "evil-example.com" {
+		t.Errorf("violations = %+v", violations)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// whoCanCmd represents the who-can command
+var whoCanCmd = &cobra.Command{
+	Use:   "who-can",
+	Short: "List everyone with access to a repository",
+	Long: `List everyone with access to a repository.
+
+Every user with access to the repository given by --repo is printed with
+their effective permission and the grant it comes from, expanding the
+members of teams and of their child teams, the organization owners and the
+base permission of the organization. --min only lists users with at least
+that permission, so who can push to a repository is:
+
+  gh aac who-can --repo api --min WRITE
+
+The access configuration file is read by default. With --live the
+organization is exported from GitHub instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, _ := cmd.Flags().GetString("repo")
+		min, _ := cmd.Flags().GetString("min")
+		live, _ := cmd.Flags().GetBool("live")
+		format, _ := cmd.Flags().GetString("output")
+		if permissionRank(min) == 0 {
+			log.Fatalf("Invalid --min %q: use READ, TRIAGE, WRITE, MAINTAIN or ADMIN", min)
+		}
+
+		config, err := loadOrExportConfig(context.Background(), live)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !hasRepository(config, repo) {
+			log.Fatalf("Unknown repository %q in %s", repo, config.Organization.Login)
+		}
+
+		permissions := whoCan(config, repo, min)
+		if format == "json" {
+			data, err := json.MarshalIndent(permissions, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println(string(data))
+			return
+		}
+		for _, permission := range permissions {
+			fmt.Printf("%-20s %s\n", permission.Login, permission.Grants[0].Describe())
+		}
+		if len(permissions) == 0 {
+			fmt.Printf("Nobody has %s or higher on %s\n", strings.ToUpper(min), repo)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whoCanCmd)
+	whoCanCmd.Flags().String("repo", "", "Repository to list the users of")
+	whoCanCmd.Flags().String("min", "READ", "Lowest permission to list: READ, TRIAGE, WRITE, MAINTAIN or ADMIN")
+	whoCanCmd.Flags().Bool("live", false, "Export the organization from GitHub instead of reading the access configuration file")
+	whoCanCmd.Flags().String("output", "text", "Output format: text or json")
+	whoCanCmd.MarkFlagRequired("repo")
+}
+
+// whoCan returns the effective permissions on repo of at least min, from the
+// highest permission down.
+func whoCan(config *AccessConfig, repo string, min string) []EffectivePermission {
+	var permissions []EffectivePermission
+	for _, permission := range resolveRepoPermissions(config, repo) {
+		if permissionRank(permission.Access) >= permissionRank(min) {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.SliceStable(permissions, func(i, j int) bool {
+		return permissionRank(permissions[i].Access) > permissionRank(permissions[j].Access)
+	})
+	return permissions
+}
+
+// hasRepository reports whether config has the repository or a permission on it.
+func hasRepository(config *AccessConfig, repo string) bool {
+	for _, repository := range config.Repositories {
+		if strings.EqualFold(repository.Name, repo) {
+			return true
+		}
+	}
+	for _, permission := range config.Permissions.Users {
+		if strings.EqualFold(permission.Repo, repo) {
+			return true
+		}
+	}
+	for _, permission := range config.Permissions.Teams {
+		if strings.EqualFold(permission.Repo, repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadOrExportConfig reads the access configuration file or, when live is
+// set, exports the organization from GitHub.
+func loadOrExportConfig(ctx context.Context, live bool) (*AccessConfig, error) {
+	if !live {
+		config, err := LoadConfig(viper.GetString("aac-path"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		return config, nil
+	}
+
+	organization, err := targetOrganization()
+	if err != nil {
+		return nil, err
+	}
+	pool := newWorkerPool(viper.GetInt("concurrency"))
+	provider, err := newGitHubProvider(ctx, organization)
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := exportOrganization(ctx, pool, provider, organization, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export %s: %w", organization, err)
+	}
+	return config, nil
+}
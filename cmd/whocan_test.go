@@ -0,0 +1,81 @@
+/*
+Copyright © 2023 Agustin Larreinegabe
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWhoCan(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+
+	var got []string
+	for _, permission := range whoCan(config, "API", "WRITE") {
+		got = append(got, permission.Login+" "+permission.Grants[0].Describe())
+	}
+	want := []string{
+		"alice ADMIN as organization owner",
+		"bob MAINTAIN through team backend",
+		"carol MAINTAIN through team backend",
+		"dave WRITE through team engineering",
+		"erin WRITE through team platform → engineering",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("who can write to api:\n got %q\nwant %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("who can write to api [%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	// Everyone in the organization can read through the base permission,
+	// but only collaborators outside of it with a direct grant.
+	readers := whoCan(config, "tools", "READ")
+	if len(readers) != 7 || readers[0].Login != "alice" || readers[1].Login != "mallory" {
+		t.Errorf("who can read tools = %+v", readers)
+	}
+}
+
+func TestWhoCanLive(t *testing.T) {
+	f := newFakeGitHub(t, 2, loadFixture(t, "acme.yaml"))
+	f.installations["acme"] = 1
+	useGitHubApp(t, f)
+	organizationList = []string{"acme"}
+	t.Cleanup(func() { organizationList = nil })
+
+	config, err := loadOrExportConfig(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if permissions := whoCan(config, "infra", "ADMIN"); len(permissions) != 2 {
+		t.Errorf("who can administer infra = %+v", permissions)
+	}
+}
+
+func TestHasRepository(t *testing.T) {
+	config := loadFixture(t, "acme.yaml")
+	if !hasRepository(config, "Docs") || hasRepository(config, "missing") {
+		t.Error("hasRepository does not match the repositories of the fixture")
+	}
+}